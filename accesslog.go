@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// Enough to tell accounts apart in logs, without logging the full fingerprint
+const loggedFingerprintLen = 12
+
+// shortFingerprint returns the beginning of a certificate fingerprint, for
+// logs
+func shortFingerprint(fingerprint string) string {
+	return fingerprint[:min(len(fingerprint), loggedFingerprintLen)]
+}
+
+func newAccessLogger(w io.Writer, format string) (*slog.Logger, error) {
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, nil)), nil
+	case "logfmt":
+		return slog.New(slog.NewTextHandler(w, nil)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected json or logfmt", format)
+	}
+}
+
+// statusResponseWriter records the status and size of the response
+type statusResponseWriter struct {
+	gemini.ResponseWriter
+	status      gemini.Status
+	wrote       int
+	mediatype   string
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) SetMediaType(mediatype string) {
+	w.mediatype = mediatype
+	w.ResponseWriter.SetMediaType(mediatype)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		meta := w.mediatype
+		if meta == "" {
+			meta = "text/gemini"
+		}
+		w.WriteHeader(gemini.StatusSuccess, meta)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.wrote += n
+	return n, err
+}
+
+func (w *statusResponseWriter) WriteHeader(status gemini.Status, meta string) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	w.ResponseWriter.WriteHeader(status, meta)
+}
+
+// Status returns the status of the response, once the handler returned
+func (w *statusResponseWriter) Status() gemini.Status {
+	if !w.wroteHeader {
+		// Sent by go-gemini for handlers writing nothing
+		return gemini.StatusTemporaryFailure
+	}
+	return w.status
+}
+
+// AccessLogMiddleware logs every request with its status, size and latency
+type AccessLogMiddleware struct {
+	logger *slog.Logger
+	h      gemini.Handler
+}
+
+func NewAccessLogMiddleware(logger *slog.Logger, h gemini.Handler) (*AccessLogMiddleware, error) {
+	if logger == nil || h == nil {
+		return nil, fmt.Errorf(
+			"NewAccessLogMiddleware: nil values not allowed",
+		)
+	}
+	return &AccessLogMiddleware{logger, h}, nil
+}
+
+func (am *AccessLogMiddleware) ServeGemini(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	start := time.Now()
+	sw := &statusResponseWriter{ResponseWriter: w}
+	am.h.ServeGemini(ctx, sw, r)
+
+	user := ""
+	if tls := r.TLS(); tls != nil && len(tls.PeerCertificates) > 0 {
+		user = shortFingerprint(fingerprint(tls.PeerCertificates[0]))
+	}
+	am.logger.LogAttrs(ctx, slog.LevelInfo, "request",
+		slog.String("path", r.URL.Path),
+		slog.Int("status", int(sw.Status())),
+		slog.Int("bytes", sw.wrote),
+		slog.Duration("latency", time.Since(start)),
+		slog.String("user", user),
+		slog.String("remote", remoteIP(r)),
+	)
+}
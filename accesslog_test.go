@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// lockedBuffer is written by the server and read by tests
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// logRequests makes the harness log requests in format, to the returned
+// buffer. /silent writes nothing, like a handler forgetting to answer
+func logRequests(t *testing.T, h *harness, format string) *lockedBuffer {
+	t.Helper()
+	logs := &lockedBuffer{}
+	logger, err := newAccessLogger(logs, format)
+	if err != nil {
+		t.Fatalf("newAccessLogger: %v", err)
+	}
+	next := h.handler
+	handler, err := NewAccessLogMiddleware(logger, gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		if r.URL.Path != "/silent" {
+			next.ServeGemini(ctx, w, r)
+		}
+	}))
+	if err != nil {
+		t.Fatalf("NewAccessLogMiddleware: %v", err)
+	}
+	h.handler = handler
+	return logs
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	h := newHarness(t)
+	logs := logRequests(t, h, "json")
+
+	_, body := h.get(t, "/entry?entryID=100", &h.cert)
+	h.get(t, "/silent", nil)
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2:\n%s", len(lines), logs)
+	}
+	var entry, silent struct {
+		Msg     string
+		Path    string
+		Status  int
+		Bytes   int
+		Latency int64
+		User    string
+		Remote  string
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	if entry.Msg != "request" || entry.Path != "/entry" || entry.Status != 20 || entry.Bytes != len(body) {
+		t.Errorf("logged %+v, want /entry with status 20 and %d bytes", entry, len(body))
+	}
+	if len(entry.User) != loggedFingerprintLen || entry.Remote != "127.0.0.1" || entry.Latency <= 0 {
+		t.Errorf("logged %+v, want a shortened fingerprint, the IP and the latency", entry)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &silent); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[1], err)
+	}
+	if silent.Status != int(gemini.StatusTemporaryFailure) || silent.User != "" {
+		t.Errorf("logged %+v without answer nor certificate, want status 40 and no user", silent)
+	}
+}
+
+func TestAccessLogLogfmt(t *testing.T) {
+	h := newHarness(t)
+	logs := logRequests(t, h, "logfmt")
+
+	h.get(t, "/silent", nil)
+
+	line := logs.String()
+	for _, want := range []string{"msg=request", "path=/silent", "status=40", "bytes=0", "user=\"\"", "remote=127.0.0.1", "latency="} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log doesn’t contain %q: %s", want, line)
+		}
+	}
+}
+
+func TestAccessLogUnknownFormat(t *testing.T) {
+	if _, err := newAccessLogger(&lockedBuffer{}, "xml"); err == nil {
+		t.Errorf("newAccessLogger accepted an unknown format")
+	}
+}
@@ -19,7 +19,9 @@ package main
 
 import (
 	"strconv"
+	"strings"
 
+	"cj.rs/miniflux-gemini/gemtext"
 	miniflux "miniflux.app/client"
 )
 
@@ -29,20 +31,27 @@ import (
 
 type ArticleList struct {
 	miniflux.Filter
+	// Tag of the entries, which the Miniflux API can’t filter on, so entries
+	// are filtered by the bridge
+	Tag string
+	// Whether the last scan for the entries with Tag stopped at its limit,
+	// with Miniflux entries left
+	ScanCut bool
 }
 
 // Default parameters used in filters, that defines the basis for the article
 // list
-func defaultFilter() miniflux.Filter {
+func defaultFilter(settings gemtext.Settings) miniflux.Filter {
 	return miniflux.Filter{
 		Status:    "unread",
-		Order:     "published_at",
-		Direction: "desc",
+		Order:     settings.Order,
+		Direction: settings.Direction,
+		Limit:     settings.PageSize,
 	}
 }
 
-func NewArticleList() ArticleList {
-	return ArticleList{defaultFilter()}
+func NewArticleList(settings gemtext.Settings) ArticleList {
+	return ArticleList{Filter: defaultFilter(settings)}
 }
 
 // ExtendFilter takes net/url.Url.Values (in the generic form of a map) and
@@ -118,13 +127,102 @@ func (al *ArticleList) Extend(values map[string][]string) {
 	if k, exists := values["statuses"]; exists {
 		al.Statuses = k
 	}
+	if k, exists := values["tag"]; exists {
+		al.Tag = strings.TrimSpace(k[0])
+	}
+}
+
+// The entries endpoint of the Miniflux API takes no tag, see
+// https://miniflux.app/docs/api.html#endpoint-get-entries and the Filter of
+// its client, so entries with a tag are looked for among the recent ones
+const (
+	// Entries requested at once when filtering them by tag
+	tagPageSize = 100
+	// Entries filtered by tag at most, so that rare tags don’t page through
+	// the whole history
+	maxTagScan = 1000
+	// Entries the ones with a tag are counted among, as the home page counts
+	// them for each saved view
+	maxTagCount = tagPageSize
+)
+
+// Entries returns the entries of the list. With a tag, Miniflux entries
+// matching the rest of the filter are paged through until the entries of the
+// list are found, among the first maxTagScan, so Total only counts the ones
+// found so far: use Count for the number of entries
+func (al *ArticleList) Entries(client *MinifluxClient) (*miniflux.EntryResultSet, error) {
+	if al.Tag == "" {
+		return client.Entries(&al.Filter)
+	}
+
+	result := &miniflux.EntryResultSet{Entries: miniflux.Entries{}}
+	err := al.scanTag(client, maxTagScan, func(entry *miniflux.Entry) bool {
+		if result.Total >= al.Offset {
+			result.Entries = append(result.Entries, entry)
+		}
+		result.Total++
+		return al.Limit <= 0 || len(result.Entries) < al.Limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Count returns the number of entries of the list. With a tag, only the ones
+// among the first maxTagCount entries of the rest of the filter are counted
+func (al *ArticleList) Count(client *MinifluxClient) (int, error) {
+	if al.Tag == "" {
+		filter := al.Filter
+		filter.Limit = 1
+		entries, err := client.Entries(&filter)
+		if err != nil {
+			return 0, err
+		}
+		return entries.Total, nil
+	}
+
+	count := 0
+	err := al.scanTag(client, maxTagCount, func(*miniflux.Entry) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+// scanTag pages through the Miniflux entries matching the filter other than
+// the tag and offset, and calls found with the ones with the tag until it
+// returns false or limit entries were read, setting ScanCut in the latter case
+func (al *ArticleList) scanTag(client *MinifluxClient, limit int, found func(*miniflux.Entry) bool) error {
+	al.ScanCut = false
+	filter := al.Filter
+	filter.Offset, filter.Limit = 0, min(tagPageSize, limit)
+	for {
+		page, err := client.Entries(&filter)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page.Entries {
+			if gemtext.HasTag(entry, al.Tag) && !found(entry) {
+				return nil
+			}
+		}
+		filter.Offset += len(page.Entries)
+		if len(page.Entries) < filter.Limit || filter.Offset >= page.Total {
+			return nil
+		}
+		if filter.Offset >= limit {
+			al.ScanCut = true
+			return nil
+		}
+	}
 }
 
 // First returns the first entry
-func (al *ArticleList) First(client *miniflux.Client) (*miniflux.Entry, error) {
+func (al *ArticleList) First(client *MinifluxClient) (*miniflux.Entry, error) {
 	prevLimit := al.Filter.Limit
 	al.Filter.Limit = 1
-	entrySet, err := client.Entries(&al.Filter)
+	entrySet, err := al.Entries(client)
 	if err != nil {
 		return nil, err
 	}
@@ -139,4 +237,3 @@ func (al *ArticleList) First(client *miniflux.Client) (*miniflux.Entry, error) {
 	}
 	return entry, err
 }
-
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"cj.rs/miniflux-gemini/gemtext"
+)
+
+func FuzzArticleListExtend(f *testing.F) {
+	f.Add("offset=2&limit=10&feedID=10&categoryID=1&starred=true")
+	f.Add("statuses=unread&statuses=read&search=a%0Ab&before=-1&afterEntryID=x")
+	f.Add("offset=&limit&status")
+	f.Add("tag=%20Go%20&tag=News")
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return
+		}
+
+		articleList := NewArticleList(gemtext.DefaultSettings())
+		articleList.Extend(query)
+
+		if starred := articleList.Starred; starred != "" && starred != "true" && starred != "false" {
+			t.Fatalf("starred = %q, want true or false", starred)
+		}
+		if statuses, ok := query["statuses"]; ok && !slices.Equal(articleList.Statuses, statuses) {
+			t.Fatalf("statuses = %q, want %q", articleList.Statuses, statuses)
+		}
+		if search, ok := query["search"]; ok && articleList.Search != search[0] {
+			t.Fatalf("search = %q, want %q", articleList.Search, search[0])
+		}
+		if tag, ok := query["tag"]; ok && articleList.Tag != strings.TrimSpace(tag[0]) {
+			t.Fatalf("tag = %q, want %q", articleList.Tag, tag[0])
+		}
+	})
+}
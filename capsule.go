@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"cj.rs/miniflux-gemini/gemtext"
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// capsuleFeeds serves the feeds of Gemini capsules as Atom over HTTP, at
+// /gemini-feed?url=gemini://…, so that Miniflux, which can’t fetch gemini://
+// URLs, can subscribe to them. Like the media proxy, it only reaches public
+// addresses unless allowed otherwise.
+type capsuleFeeds struct {
+	client *gemini.Client
+	// Shared with Miniflux, which passes it in the token parameter, so that
+	// others can’t make the server fetch capsules
+	token string
+
+	mu sync.Mutex
+	// Rendered feeds by URL, Miniflux polls them again and again
+	cache map[string]cachedCapsule
+}
+
+type cachedCapsule struct {
+	atom    []byte
+	expires time.Time
+}
+
+const (
+	// Of the index and of each entry
+	maxCapsuleSize = 2 << 20
+	// Entries fetched for their content, the latest ones of the index
+	maxCapsuleEntries   = 20
+	maxCapsuleRedirects = 5
+	// For the index and all its entries, Miniflux waits for 20 seconds by
+	// default
+	capsuleTimeout = 15 * time.Second
+	// Feeds are fetched again after that
+	capsuleCacheTTL   = 15 * time.Minute
+	maxCachedCapsules = 1000
+)
+
+func newCapsuleFeeds(allowPrivate bool, token string) *capsuleFeeds {
+	dialer := &net.Dialer{Timeout: fetchTimeout}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+	// Capsules mostly use self-signed certificates, that the client accepts
+	return &capsuleFeeds{
+		client: &gemini.Client{DialContext: dialer.DialContext},
+		token:  token,
+		cache:  make(map[string]cachedCapsule),
+	}
+}
+
+// cached returns the feed of target rendered less than capsuleCacheTTL ago
+func (c *capsuleFeeds) cached(target string, now time.Time) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	feed, ok := c.cache[target]
+	if !ok || now.After(feed.expires) {
+		return nil, false
+	}
+	return feed.atom, true
+}
+
+func (c *capsuleFeeds) store(target string, atom []byte, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxCachedCapsules {
+		for key, feed := range c.cache {
+			if now.After(feed.expires) {
+				delete(c.cache, key)
+			}
+		}
+	}
+	if len(c.cache) < maxCachedCapsules {
+		c.cache[target] = cachedCapsule{atom: atom, expires: now.Add(capsuleCacheTTL)}
+	}
+}
+
+// get fetches the gemini:// URL target, following redirects, and returns the
+// media type of the answer, its content and its final URL
+func (c *capsuleFeeds) get(ctx context.Context, target string) (string, []byte, *url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	for range maxCapsuleRedirects + 1 {
+		if u.Scheme != "gemini" {
+			return "", nil, nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+		}
+		resp, err := c.client.Get(ctx, u.String())
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		switch resp.Status.Class() {
+		case gemini.StatusSuccess:
+			defer resp.Body.Close()
+			body, err := io.ReadAll(io.LimitReader(resp.Body, maxCapsuleSize+1))
+			if err != nil {
+				return "", nil, nil, err
+			}
+			if len(body) > maxCapsuleSize {
+				return "", nil, nil, fmt.Errorf("%w: more than %d bytes", errTooLarge, maxCapsuleSize)
+			}
+			mediaType, _, err := mime.ParseMediaType(resp.Meta)
+			if err != nil {
+				// Gemini defaults to gemtext
+				mediaType = "text/gemini"
+			}
+			return mediaType, body, u, nil
+		case gemini.StatusRedirect:
+			resp.Body.Close()
+			if u, err = u.Parse(resp.Meta); err != nil {
+				return "", nil, nil, err
+			}
+		default:
+			resp.Body.Close()
+			return "", nil, nil, fmt.Errorf("status %d: %s", resp.Status, resp.Meta)
+		}
+	}
+	return "", nil, nil, fmt.Errorf("more than %d redirects", maxCapsuleRedirects)
+}
+
+func (c *capsuleFeeds) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/gemini-feed" {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("token")), []byte(c.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusForbidden)
+		return
+	}
+	target := query.Get("url")
+	if u, err := url.Parse(target); err != nil || u.Scheme != "gemini" || u.Host == "" {
+		http.Error(w, "url must be a gemini:// URL", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if atom, ok := c.cached(target, time.Now()); ok {
+		w.Write(atom)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), capsuleTimeout)
+	defer cancel()
+	mediaType, body, base, err := c.get(ctx, target)
+	if err != nil {
+		log.Printf("error getting capsule feed %q: %v", target, err)
+		http.Error(w, "couldn’t get the capsule", http.StatusBadGateway)
+		return
+	}
+
+	var feed *gemtext.CapsuleFeed
+	switch {
+	case mediaType == "text/gemini":
+		feed = gemtext.ParseGemfeed(string(body), base)
+	case mediaType == "application/atom+xml", strings.HasSuffix(mediaType, "/xml"):
+		feed, err = gemtext.ParseAtom(body, base)
+		if err != nil {
+			log.Printf("error parsing capsule feed %q: %v", target, err)
+			http.Error(w, "invalid Atom feed", http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("%s isn’t a gemfeed or an Atom feed", mediaType), http.StatusBadGateway)
+		return
+	}
+
+	if len(feed.Entries) > maxCapsuleEntries {
+		feed.Entries = feed.Entries[:maxCapsuleEntries]
+	}
+	for _, entry := range feed.Entries {
+		if entry.Content != "" || !strings.HasPrefix(entry.URL, "gemini://") {
+			continue
+		}
+		// Entries that can’t be fetched are still listed, with their link
+		mediaType, body, base, err := c.get(ctx, entry.URL)
+		switch {
+		case err != nil:
+			log.Printf("error getting capsule entry %q: %v", entry.URL, err)
+		case mediaType == "text/gemini":
+			entry.Content = gemtext.GemtextToHTML(string(body), base)
+		case strings.HasPrefix(mediaType, "text/"):
+			entry.Content = "<pre>" + html.EscapeString(string(body)) + "</pre>"
+		}
+	}
+
+	var atom bytes.Buffer
+	if err := feed.RenderAtom(&atom); err != nil {
+		log.Printf("error rendering capsule feed: %v", err)
+		http.Error(w, "couldn’t render the feed", http.StatusInternalServerError)
+		return
+	}
+	c.store(target, atom.Bytes(), time.Now())
+	w.Write(atom.Bytes())
+}
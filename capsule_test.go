@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// newCapsule serves pages over Gemini on a loopback port, by path, and
+// returns its gemini:// URL
+func newCapsule(t *testing.T, pages map[string]string) string {
+	t.Helper()
+
+	mux := &gemini.Mux{}
+	mux.HandleFunc("/", func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		page, ok := pages[r.URL.Path]
+		switch {
+		case !ok:
+			w.WriteHeader(gemini.StatusNotFound, "Not found")
+		case strings.HasPrefix(page, "=> "):
+			w.WriteHeader(gemini.StatusRedirect, strings.TrimPrefix(page, "=> "))
+		case strings.HasPrefix(page, "<?xml"):
+			w.SetMediaType("application/atom+xml")
+			io.WriteString(w, page)
+		default:
+			io.WriteString(w, page)
+		}
+	})
+
+	cert := newCertificate(t, "localhost")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	listener = tls.NewListener(listener, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	})
+	server := &gemini.Server{Handler: mux}
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.Serve(ctx, listener)
+	t.Cleanup(cancel)
+
+	return "gemini://" + listener.Addr().String()
+}
+
+// Passed by getCapsuleFeed
+const testFeedToken = "secret"
+
+func getCapsuleFeed(t *testing.T, capsules *capsuleFeeds, target string) (int, string) {
+	t.Helper()
+	server := httptest.NewServer(capsules)
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/gemini-feed?token=" + testFeedToken + "&url=" + url.QueryEscape(target))
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading the answer: %v", err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestCapsuleFeedGemfeed(t *testing.T) {
+	capsule := newCapsule(t, map[string]string{
+		"/gemlog/":           "# My gemlog\n\n=> /about.gmi About\n=> first.gmi 2024-03-01 - First post\n=> second.gmi 2024-03-10 Second post\n",
+		"/gemlog/first.gmi":  "# First post\nHello <world>\n=> /about.gmi About me\n",
+		"/gemlog/second.gmi": "=> /gemlog/moved.gmi",
+		"/gemlog/moved.gmi":  "* Moved here\n",
+	})
+
+	status, body := getCapsuleFeed(t, newCapsuleFeeds(true, testFeedToken), capsule+"/gemlog/")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	for _, want := range []string{
+		"<title>My gemlog</title>",
+		"<title>First post</title>",
+		"<id>" + capsule + "/gemlog/first.gmi</id>",
+		"<updated>2024-03-10T00:00:00Z</updated>",
+		"Hello &amp;lt;world&amp;gt;",
+		`&lt;a href=&#34;` + capsule + `/about.gmi&#34;&gt;About me&lt;/a&gt;`,
+		"&lt;li&gt;Moved here&lt;/li&gt;",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed doesn’t contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, "Second post") > strings.Index(body, "First post") {
+		t.Errorf("entries aren’t sorted newest first:\n%s", body)
+	}
+	if strings.Contains(body, "<title>About</title>") {
+		t.Errorf("feed lists a link without date:\n%s", body)
+	}
+}
+
+func TestCapsuleFeedAtom(t *testing.T) {
+	capsule := newCapsule(t, map[string]string{
+		"/atom.xml": `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Atom gemlog</title>
+  <entry>
+    <title>With content</title>
+    <link href="/with-content.gmi"/>
+    <updated>2024-03-10T12:00:00Z</updated>
+    <content type="html">&lt;p&gt;Already there&lt;/p&gt;</content>
+  </entry>
+  <entry>
+    <title>Without link</title>
+    <id>urn:uuid:60a76c80-d399-11d9-b93C-0003939e0af6</id>
+  </entry>
+  <entry>
+    <title>Without content</title>
+    <link href="without-content.gmi"/>
+    <updated>2024-03-09T12:00:00Z</updated>
+  </entry>
+</feed>`,
+		"/without-content.gmi": "Fetched\n",
+	})
+
+	status, body := getCapsuleFeed(t, newCapsuleFeeds(true, testFeedToken), capsule+"/atom.xml")
+	if status != http.StatusOK {
+		t.Fatalf("status = %d: %s", status, body)
+	}
+	for _, want := range []string{
+		"<title>Atom gemlog</title>",
+		"<id>" + capsule + "/with-content.gmi</id>",
+		"&lt;p&gt;Already there&lt;/p&gt;",
+		"&lt;p&gt;Fetched&lt;/p&gt;",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed doesn’t contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Without link") || strings.Contains(body, "<id></id>") {
+		t.Errorf("feed lists an entry without link:\n%s", body)
+	}
+}
+
+func TestCapsuleFeedRefused(t *testing.T) {
+	capsule := newCapsule(t, map[string]string{"/": "# Capsule\n"})
+
+	for _, tt := range []struct {
+		name     string
+		capsules *capsuleFeeds
+		target   string
+		status   int
+	}{
+		{"not gemini", newCapsuleFeeds(true, testFeedToken), "https://example.com/", http.StatusBadRequest},
+		{"private address", newCapsuleFeeds(false, testFeedToken), capsule + "/", http.StatusBadGateway},
+		{"not found", newCapsuleFeeds(true, testFeedToken), capsule + "/missing", http.StatusBadGateway},
+	} {
+		if status, body := getCapsuleFeed(t, tt.capsules, tt.target); status != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, status, tt.status, body)
+		}
+	}
+}
+
+func TestCapsuleFeedToken(t *testing.T) {
+	capsule := newCapsule(t, map[string]string{"/": "# Capsule\n"})
+	server := httptest.NewServer(newCapsuleFeeds(true, testFeedToken))
+	t.Cleanup(server.Close)
+
+	for _, query := range []string{"", "token=&", "token=guess&"} {
+		resp, err := http.Get(server.URL + "/gemini-feed?" + query + "url=" + url.QueryEscape(capsule+"/"))
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("status = %d with %q, want %d", resp.StatusCode, query, http.StatusForbidden)
+		}
+	}
+}
+
+func TestCapsuleFeedCache(t *testing.T) {
+	capsule := newCapsule(t, map[string]string{"/": "# Capsule\n=> first.gmi 2024-03-01 First post\n"})
+	capsules := newCapsuleFeeds(true, testFeedToken)
+
+	_, first := getCapsuleFeed(t, capsules, capsule+"/")
+	if _, ok := capsules.cached(capsule+"/", time.Now()); !ok {
+		t.Fatalf("feed isn’t cached")
+	}
+	// Replaced in the cache, to tell it apart from a new fetch
+	capsules.store(capsule+"/", []byte("cached"), time.Now())
+	if _, body := getCapsuleFeed(t, capsules, capsule+"/"); body != "cached" {
+		t.Errorf("feed isn’t served from the cache: %s", body)
+	}
+	if _, ok := capsules.cached(capsule+"/", time.Now().Add(capsuleCacheTTL+time.Second)); ok {
+		t.Errorf("feed is still cached after %v", capsuleCacheTTL)
+	}
+	if !strings.Contains(first, "First post") {
+		t.Errorf("first feed doesn’t contain the entry:\n%s", first)
+	}
+}
@@ -18,10 +18,14 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	_ "embed"
 	"fmt"
+	"net/url"
+	"os"
 
+	"cj.rs/miniflux-gemini/gemtext"
 	_ "modernc.org/sqlite"
 )
 
@@ -45,12 +49,139 @@ func NewDB(f string) (*SqliteDB, error) {
 	if _, err = db.Exec(schema); err != nil {
 		return nil, err
 	}
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("error migrating the database: %w", err)
+	}
+
+	return &SqliteDB{db: db}, nil
+}
 
+// OpenDBReadOnly opens the database in file f without creating it, applying
+// the schema nor migrating it, for checks that mustn’t change it
+func OpenDBReadOnly(f string) (*SqliteDB, error) {
+	if _, err := os.Stat(f); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+f+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
 	return &SqliteDB{db: db}, nil
 }
 
+// migrations bring tables created by earlier versions to the schema, as
+// CREATE TABLE IF NOT EXISTS leaves them as they are. Databases are at the
+// version of the last step they went through, in PRAGMA user_version. Steps
+// get the columns of Settings, as databases created since have them already
+var migrations = []func(tx *sql.Tx, columns map[string]bool) error{
+	migrateAutoMarkRead,
+	migrateLanguage,
+	migratePageLength,
+}
+
+// migrate runs the steps the database didn’t go through, each in its own
+// transaction
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		if err := migrateTo(db, version+1); err != nil {
+			return fmt.Errorf("version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+func migrateTo(db *sql.DB, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	columns, err := settingsColumns(tx)
+	if err != nil {
+		return err
+	}
+	if err := migrations[version-1](tx, columns); err != nil {
+		return err
+	}
+	// PRAGMA doesn’t take parameters
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// settingsColumns returns the names of the columns of Settings
+func settingsColumns(tx *sql.Tx) (map[string]bool, error) {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info('Settings')")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// execSteps runs the statements of a migration step
+func execSteps(tx *sql.Tx, steps ...string) error {
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			return fmt.Errorf("%s: %w", step, err)
+		}
+	}
+	return nil
+}
+
+// migrateAutoMarkRead replaces markReadOnOpen with autoMarkRead, which also
+// marks entries read when moving to the next one
+func migrateAutoMarkRead(tx *sql.Tx, columns map[string]bool) error {
+	if !columns["markReadOnOpen"] {
+		return nil
+	}
+	return execSteps(tx,
+		fmt.Sprintf(`ALTER TABLE Settings ADD COLUMN autoMarkRead TEXT NOT NULL DEFAULT '%s'`, gemtext.DefaultSettings().AutoMarkRead),
+		fmt.Sprintf(`UPDATE Settings SET autoMarkRead='%s' WHERE markReadOnOpen=1`, gemtext.AutoMarkReadOpen),
+		`ALTER TABLE Settings DROP COLUMN markReadOnOpen`,
+	)
+}
+
+// migrateLanguage adds the language column, empty for the one of the Miniflux
+// profile
+func migrateLanguage(tx *sql.Tx, columns map[string]bool) error {
+	if columns["language"] {
+		return nil
+	}
+	return execSteps(tx, fmt.Sprintf(`ALTER TABLE Settings ADD COLUMN language TEXT NOT NULL DEFAULT '%s'`, gemtext.DefaultSettings().Language))
+}
+
+// migratePageLength adds the pageLength column, so that long entries aren’t
+// split unless users ask for it
+func migratePageLength(tx *sql.Tx, columns map[string]bool) error {
+	if columns["pageLength"] {
+		return nil
+	}
+	return execSteps(tx, fmt.Sprintf(`ALTER TABLE Settings ADD COLUMN pageLength INTEGER NOT NULL DEFAULT %d`, gemtext.DefaultSettings().PageLength))
+}
+
 type User struct {
 	certFingerprint, instance, token string
+	settings                         gemtext.Settings
+	// Conversion options overridden for each feed, and for all under 0
+	conversions map[int64]url.Values
 }
 
 var ErrUserNotFound = fmt.Errorf("User not found in DB")
@@ -64,8 +195,166 @@ func (s *SqliteDB) GetUser(certFingerprint string) (user User, err error) {
 		return user, ErrUserNotFound
 	}
 	if err != nil {
-		return user, fmt.Errorf("error reading user with cert %q: %w", certFingerprint, err)
+		return user, fmt.Errorf("error reading user with cert %q: %w", shortFingerprint(certFingerprint), err)
 	}
 	return user, nil
 }
 
+// Ping checks that the database is still reachable
+func (s *SqliteDB) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Instances returns the Miniflux instances used by at least one user
+func (s *SqliteDB) Instances() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT instance FROM Users")
+	if err != nil {
+		return nil, fmt.Errorf("error listing instances: %w", err)
+	}
+	defer rows.Close()
+
+	var instances []string
+	for rows.Next() {
+		var instance string
+		if err := rows.Scan(&instance); err != nil {
+			return nil, fmt.Errorf("error reading instance: %w", err)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, rows.Err()
+}
+
+// GetSettings returns the settings of the user, or the default ones if they
+// were never changed
+func (s *SqliteDB) GetSettings(certFingerprint string) (gemtext.Settings, error) {
+	settings := gemtext.DefaultSettings()
+	row := s.db.QueryRow(`SELECT entryOrder, entryDirection, pageSize, autoMarkRead, dateFormat, timezone, language, hideEmptyFeeds, pageLength
+		FROM Settings WHERE certFingerprint=?1`, certFingerprint)
+	err := row.Scan(
+		&settings.Order, &settings.Direction, &settings.PageSize, &settings.AutoMarkRead,
+		&settings.DateFormat, &settings.Timezone, &settings.Language, &settings.HideEmptyFeeds, &settings.PageLength,
+	)
+	if err == sql.ErrNoRows {
+		return gemtext.DefaultSettings(), nil
+	}
+	if err != nil {
+		return settings, fmt.Errorf("error reading settings of %q: %w", shortFingerprint(certFingerprint), err)
+	}
+	return settings, nil
+}
+
+// SaveSettings creates or replaces the settings of the user
+func (s *SqliteDB) SaveSettings(certFingerprint string, settings gemtext.Settings) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO Settings
+		(certFingerprint, entryOrder, entryDirection, pageSize, autoMarkRead, dateFormat, timezone, language, hideEmptyFeeds, pageLength)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9, ?10)`,
+		certFingerprint, settings.Order, settings.Direction, settings.PageSize, settings.AutoMarkRead,
+		settings.DateFormat, settings.Timezone, settings.Language, settings.HideEmptyFeeds, settings.PageLength,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving settings of %q: %w", shortFingerprint(certFingerprint), err)
+	}
+	return nil
+}
+
+// GetConversions returns the conversion options overridden by the user, by
+// feed ID. Options for all feeds are under 0.
+func (s *SqliteDB) GetConversions(certFingerprint string) (map[int64]url.Values, error) {
+	rows, err := s.db.Query(`SELECT feedID, options FROM ConversionOptions WHERE certFingerprint=?1`, certFingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("error reading conversion options of %q: %w", shortFingerprint(certFingerprint), err)
+	}
+	defer rows.Close()
+
+	conversions := make(map[int64]url.Values)
+	for rows.Next() {
+		var feedID int64
+		var options string
+		if err := rows.Scan(&feedID, &options); err != nil {
+			return nil, fmt.Errorf("error reading conversion options of %q: %w", shortFingerprint(certFingerprint), err)
+		}
+		conversions[feedID], err = url.ParseQuery(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid conversion options of %q for feed %d: %w", shortFingerprint(certFingerprint), feedID, err)
+		}
+	}
+	return conversions, rows.Err()
+}
+
+// SaveConversion replaces the conversion options overridden by the user for
+// the feed, 0 for all feeds
+func (s *SqliteDB) SaveConversion(certFingerprint string, feedID int64, overrides url.Values) error {
+	var err error
+	if len(overrides) == 0 {
+		_, err = s.db.Exec(`DELETE FROM ConversionOptions WHERE certFingerprint=?1 AND feedID=?2`,
+			certFingerprint, feedID)
+	} else {
+		_, err = s.db.Exec(`INSERT OR REPLACE INTO ConversionOptions (certFingerprint, feedID, options)
+			VALUES (?1, ?2, ?3)`, certFingerprint, feedID, overrides.Encode())
+	}
+	if err != nil {
+		return fmt.Errorf("error saving conversion options of %q: %w", shortFingerprint(certFingerprint), err)
+	}
+	return nil
+}
+
+// GetViews returns the views saved by the user, in the order they were created
+func (s *SqliteDB) GetViews(certFingerprint string) ([]*gemtext.SavedView, error) {
+	rows, err := s.db.Query(`SELECT id, name, filter FROM Views WHERE certFingerprint=?1 ORDER BY id`, certFingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("error reading views of %q: %w", shortFingerprint(certFingerprint), err)
+	}
+	defer rows.Close()
+
+	var views []*gemtext.SavedView
+	for rows.Next() {
+		view := &gemtext.SavedView{}
+		var filter string
+		if err := rows.Scan(&view.ID, &view.Name, &filter); err != nil {
+			return nil, fmt.Errorf("error reading views of %q: %w", shortFingerprint(certFingerprint), err)
+		}
+		view.Filter, err = url.ParseQuery(filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter of view %d of %q: %w", view.ID, shortFingerprint(certFingerprint), err)
+		}
+		views = append(views, view)
+	}
+	return views, rows.Err()
+}
+
+// SaveView creates the view when its ID is 0, setting the ID, and updates it
+// otherwise
+func (s *SqliteDB) SaveView(certFingerprint string, view *gemtext.SavedView) error {
+	if view.ID == 0 {
+		result, err := s.db.Exec(`INSERT INTO Views (certFingerprint, name, filter) VALUES (?1, ?2, ?3)`,
+			certFingerprint, view.Name, view.Filter.Encode())
+		if err != nil {
+			return fmt.Errorf("error saving view of %q: %w", shortFingerprint(certFingerprint), err)
+		}
+		view.ID, err = result.LastInsertId()
+		return err
+	}
+	result, err := s.db.Exec(`UPDATE Views SET name=?3, filter=?4 WHERE certFingerprint=?1 AND id=?2`,
+		certFingerprint, view.ID, view.Name, view.Filter.Encode())
+	if err != nil {
+		return fmt.Errorf("error saving view %d of %q: %w", view.ID, shortFingerprint(certFingerprint), err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrViewNotFound
+	}
+	return nil
+}
+
+var ErrViewNotFound = fmt.Errorf("View not found in DB")
+
+// DeleteView deletes a view of the user
+func (s *SqliteDB) DeleteView(certFingerprint string, id int64) error {
+	result, err := s.db.Exec(`DELETE FROM Views WHERE certFingerprint=?1 AND id=?2`, certFingerprint, id)
+	if err != nil {
+		return fmt.Errorf("error deleting view %d of %q: %w", id, shortFingerprint(certFingerprint), err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrViewNotFound
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cj.rs/miniflux-gemini/gemtext"
+)
+
+func TestMigrateSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	// Settings as first released, before autoMarkRead, language and
+	// pageLength
+	_, err = old.Exec(`CREATE TABLE Settings (
+		certFingerprint TEXT PRIMARY KEY NOT NULL,
+		entryOrder TEXT NOT NULL,
+		entryDirection TEXT NOT NULL,
+		pageSize INTEGER NOT NULL,
+		markReadOnOpen INTEGER NOT NULL,
+		dateFormat TEXT NOT NULL,
+		timezone TEXT NOT NULL,
+		hideEmptyFeeds INTEGER NOT NULL
+	) STRICT;
+	INSERT INTO Settings VALUES ('opener', 'published_at', 'asc', 10, 1, '2006-01-02', 'UTC', 1);
+	INSERT INTO Settings VALUES ('keeper', 'published_at', 'desc', 20, 0, '2006-01-02', '', 0);`)
+	if err != nil {
+		t.Fatalf("creating the old schema: %v", err)
+	}
+	old.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	settings, err := db.GetSettings("opener")
+	if err != nil {
+		t.Fatalf("GetSettings: %v", err)
+	}
+	if settings.AutoMarkRead != gemtext.AutoMarkReadOpen || settings.Direction != "asc" || settings.PageSize != 10 || settings.PageLength != 0 {
+		t.Errorf("migrated settings = %+v", settings)
+	}
+	settings, err = db.GetSettings("keeper")
+	if err != nil {
+		t.Fatalf("GetSettings: %v", err)
+	}
+	if settings.AutoMarkRead != gemtext.AutoMarkReadNever || settings.HideEmptyFeeds || settings.Language != "" {
+		t.Errorf("migrated settings = %+v", settings)
+	}
+
+	// Opening it again is a no-op
+	db.db.Close()
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB again: %v", err)
+	}
+	if err := db.SaveSettings("keeper", gemtext.DefaultSettings()); err != nil {
+		t.Errorf("SaveSettings: %v", err)
+	}
+}
+
+func TestOpenDBReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	if _, err := OpenDBReadOnly(path); err == nil {
+		t.Errorf("OpenDBReadOnly succeeded without the file")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("OpenDBReadOnly created the file: %v", err)
+	}
+
+	if _, err := NewDB(path); err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	db, err := OpenDBReadOnly(path)
+	if err != nil {
+		t.Fatalf("OpenDBReadOnly: %v", err)
+	}
+	if _, err := db.GetSettings("nobody"); err != nil {
+		t.Errorf("GetSettings: %v", err)
+	}
+	if err := db.SaveSettings("nobody", gemtext.DefaultSettings()); err == nil {
+		t.Errorf("SaveSettings succeeded on a read-only database")
+	}
+}
+
+// createOldDB creates a database with statements of an earlier version and
+// returns its path
+func createOldDB(t *testing.T, statements string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer old.Close()
+	if _, err := old.Exec(statements); err != nil {
+		t.Fatalf("creating the old schema: %v", err)
+	}
+	return path
+}
+
+func TestMigrateLanguage(t *testing.T) {
+	// Settings once entries could be marked read when moving to the next one
+	path := createOldDB(t, `CREATE TABLE Settings (
+		certFingerprint TEXT PRIMARY KEY NOT NULL,
+		entryOrder TEXT NOT NULL,
+		entryDirection TEXT NOT NULL,
+		pageSize INTEGER NOT NULL,
+		autoMarkRead TEXT NOT NULL,
+		dateFormat TEXT NOT NULL,
+		timezone TEXT NOT NULL,
+		hideEmptyFeeds INTEGER NOT NULL
+	) STRICT;
+	INSERT INTO Settings VALUES ('next', 'published_at', 'asc', 10, 'next', '2006-01-02', 'UTC', 1);`)
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	settings, err := db.GetSettings("next")
+	if err != nil {
+		t.Fatalf("GetSettings: %v", err)
+	}
+	if settings.AutoMarkRead != gemtext.AutoMarkReadNext || settings.Language != "" || settings.PageSize != 10 {
+		t.Errorf("migrated settings = %+v", settings)
+	}
+}
+
+func TestMigratePageLength(t *testing.T) {
+	// Settings once the interface was translated, migrated to version 2
+	path := createOldDB(t, `CREATE TABLE Settings (
+		certFingerprint TEXT PRIMARY KEY NOT NULL,
+		entryOrder TEXT NOT NULL,
+		entryDirection TEXT NOT NULL,
+		pageSize INTEGER NOT NULL,
+		autoMarkRead TEXT NOT NULL,
+		dateFormat TEXT NOT NULL,
+		timezone TEXT NOT NULL,
+		language TEXT NOT NULL,
+		hideEmptyFeeds INTEGER NOT NULL
+	) STRICT;
+	INSERT INTO Settings VALUES ('french', 'published_at', 'desc', 20, 'open', '2006-01-02', '', 'fr', 0);
+	PRAGMA user_version = 2;`)
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+	settings, err := db.GetSettings("french")
+	if err != nil {
+		t.Fatalf("GetSettings: %v", err)
+	}
+	if settings.Language != "fr" || settings.AutoMarkRead != gemtext.AutoMarkReadOpen || settings.PageLength != gemtext.DefaultSettings().PageLength {
+		t.Errorf("migrated settings = %+v", settings)
+	}
+	var version int
+	if err := db.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != len(migrations) {
+		t.Errorf("user_version = %d, %v, want %d", version, err, len(migrations))
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"cj.rs/miniflux-gemini/gemtext"
+	"git.sr.ht/~adnano/go-gemini"
+	minifluxClient "miniflux.app/client"
+)
+
+// Seconds a client is asked to wait when Miniflux rate limits us. The Miniflux
+// client doesn’t expose the Retry-After header, so this is a fixed guess
+const minifluxRetryAfter = 30
+
+// minifluxStatus translates an error returned by the Miniflux client to the
+// closest Gemini status and a message that can be shown to the user, in lang
+func minifluxStatus(err error, fingerprint, lang string) (gemini.Status, string) {
+	var netErr net.Error
+	var statusErr *minifluxStatusError
+
+	switch {
+	case errors.Is(err, minifluxClient.ErrNotAuthorized),
+		errors.Is(err, minifluxClient.ErrForbidden):
+		return gemini.StatusCertificateNotAuthorized, gemtext.Translate(lang,
+			"Miniflux refused your API token, it was likely revoked. Ask your admin to enroll your certificate again: %q",
+			fingerprint,
+		)
+	case errors.Is(err, minifluxClient.ErrNotFound):
+		return gemini.StatusNotFound, gemtext.Translate(lang, "Not found in Miniflux")
+	case errors.As(err, &statusErr) && statusErr.code == http.StatusTooManyRequests:
+		return gemini.StatusSlowDown, fmt.Sprint(minifluxRetryAfter)
+	case errors.As(err, &netErr):
+		return gemini.StatusProxyError, gemtext.Translate(lang, "Miniflux is unreachable")
+	default:
+		return gemini.StatusTemporaryFailure, gemtext.Translate(lang, "Error querying miniflux")
+	}
+}
+
+// minifluxError writes the Gemini header corresponding to an error returned
+// by Miniflux and logs it, along with what we were trying to do
+func minifluxError(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request, err error, action string) {
+	fingerprint := ""
+	if user, ok := UserFromContext(ctx); ok {
+		fingerprint = user.certFingerprint
+	}
+
+	status, meta := minifluxStatus(err, fingerprint, language(ctx))
+	w.WriteHeader(status, meta)
+	log.Printf("%s %s: error %s: %v (status %d)", shortFingerprint(fingerprint), r.URL.Path, action, err, status)
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini"
+	minifluxClient "miniflux.app/client"
+)
+
+func TestMinifluxStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		err    error
+		status gemini.Status
+		meta   string
+	}{
+		{"unauthorized", minifluxClient.ErrNotAuthorized, gemini.StatusCertificateNotAuthorized, `Miniflux refused your API token, it was likely revoked. Ask your admin to enroll your certificate again: "abc"`},
+		{"forbidden", minifluxClient.ErrForbidden, gemini.StatusCertificateNotAuthorized, `Miniflux refused your API token, it was likely revoked. Ask your admin to enroll your certificate again: "abc"`},
+		{"not found", minifluxClient.ErrNotFound, gemini.StatusNotFound, "Not found in Miniflux"},
+		{"too many requests", &minifluxStatusError{code: http.StatusTooManyRequests}, gemini.StatusSlowDown, "30"},
+		{"unreachable", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, gemini.StatusProxyError, "Miniflux is unreachable"},
+		{"other status", &minifluxStatusError{code: http.StatusBadGateway}, gemini.StatusTemporaryFailure, "Error querying miniflux"},
+		{"other", minifluxClient.ErrServerError, gemini.StatusTemporaryFailure, "Error querying miniflux"},
+	} {
+		status, meta := minifluxStatus(tt.err, "abc", "en")
+		if status != tt.status || meta != tt.meta {
+			t.Errorf("%s: minifluxStatus = %d %q, want %d %q", tt.name, status, meta, tt.status, tt.meta)
+		}
+	}
+}
+
+func TestMinifluxTooManyRequests(t *testing.T) {
+	h := newHarness(t)
+	h.miniflux.mu.Lock()
+	h.miniflux.status = http.StatusTooManyRequests
+	h.miniflux.mu.Unlock()
+
+	// Rate limited calls of the client and of minifluxAPI
+	for _, path := range []string{"/", "/save?_id=100"} {
+		resp, _ := h.get(t, path, &h.cert)
+		if resp.Status != gemini.StatusSlowDown || resp.Meta != "30" {
+			t.Errorf("%s: response = %d %q, want %d %q", path, resp.Status, resp.Meta, gemini.StatusSlowDown, "30")
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// fetcher gets resources of the web for users, like media files. Feeds
+// choose the URLs, so that they can’t reach the network of the server, only
+// public addresses and the Miniflux instance of the user
+type fetcher struct {
+	// In bytes
+	maxSize int64
+	// Prefixes of the accepted MIME types, like image/
+	types []string
+	// Whether private and loopback addresses can be reached anyway
+	allowPrivate bool
+}
+
+var (
+	errTooLarge       = errors.New("too large")
+	errForbiddenType  = errors.New("forbidden type")
+	errPrivateAddress = errors.New("private address")
+	errOtherHost      = errors.New("redirect to another host")
+)
+
+const fetchTimeout = 20 * time.Second
+
+var (
+	// Without a Proxy, unlike the default transport, as it would be dialed
+	// instead of the addresses to check
+	publicClient = &http.Client{
+		Timeout: fetchTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: fetchTimeout,
+				Control: refusePrivate,
+			}).DialContext,
+			TLSHandshakeTimeout: fetchTimeout,
+		},
+	}
+	anyClient = &http.Client{Timeout: fetchTimeout}
+	// For the Miniflux instance, which can be on a private address: redirects
+	// to other hosts would reach them too
+	instanceClient = &http.Client{
+		Timeout:       fetchTimeout,
+		CheckRedirect: sameHost,
+	}
+)
+
+// sameHost refuses redirects away from the host of the first request
+func sameHost(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%w: %s", errOtherHost, req.URL.Host)
+	}
+	return nil
+}
+
+// refusePrivate is called with the resolved address of each connection,
+// including the ones of redirects, so that DNS can’t point to private ones
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addr) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, addr)
+	}
+	return nil
+}
+
+// Special-purpose ranges the methods of netip.Addr don’t cover, see
+// https://www.iana.org/assignments/iana-ipv4-special-registry and
+// https://www.iana.org/assignments/iana-ipv6-special-registry
+var deniedPrefixes = []netip.Prefix{
+	// “This network”, which Linux dials as the local host
+	netip.MustParsePrefix("0.0.0.0/8"),
+	// Shared by the clients of carrier-grade NATs
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// IETF protocol assignments
+	netip.MustParsePrefix("192.0.0.0/24"),
+	// Benchmarking, often used for internal networks
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// NAT64 and 6to4 embed IPv4 addresses, private ones included
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetch gets target and returns its MIME type, with its parameters, and its
+// content. instance is the URL of the Miniflux instance of the user, which
+// can be on a private address
+func (f *fetcher) fetch(ctx context.Context, target, instance string) (string, []byte, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	client := publicClient
+	if minifluxURL, err := url.Parse(instance); f.allowPrivate {
+		client = anyClient
+	} else if err == nil && minifluxURL.Host == u.Host {
+		client = instanceClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", "miniflux-gemini")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", errForbiddenType, err)
+	}
+	if !f.accepts(mediaType) {
+		return "", nil, fmt.Errorf("%w: %s", errForbiddenType, mediaType)
+	}
+	if resp.ContentLength > f.maxSize {
+		return "", nil, fmt.Errorf("%w: %d bytes", errTooLarge, resp.ContentLength)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(body)) > f.maxSize {
+		return "", nil, fmt.Errorf("%w: more than %d bytes", errTooLarge, f.maxSize)
+	}
+	if formatted := mime.FormatMediaType(mediaType, params); formatted != "" {
+		mediaType = formatted
+	}
+	return mediaType, body, nil
+}
+
+func (f *fetcher) accepts(mediaType string) bool {
+	for _, prefix := range f.types {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"cmp"
+	"encoding/xml"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CapsuleFeed is the feed of a Gemini capsule, read from a gemfeed index or
+// an Atom file, to serve it as Atom to Miniflux, which can’t fetch gemini://
+// URLs
+type CapsuleFeed struct {
+	Title   string
+	URL     string
+	Entries []*CapsuleEntry
+}
+
+type CapsuleEntry struct {
+	Title   string
+	URL     string
+	Updated time.Time
+	// HTML, empty until the entry is fetched when the feed doesn’t have it
+	Content string
+}
+
+// Link lines of gemfeeds are labelled with a date, and then the title
+var gemfeedLink = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s*[-–—:]?\s*(.*)$`)
+
+// ParseGemfeed reads a gemtext page following the “Subscribing to Gemini
+// pages” convention: its first heading is the title, and link lines
+// labelled with a date are entries. Links are resolved against base, and
+// entries sorted newest first.
+func ParseGemfeed(text string, base *url.URL) *CapsuleFeed {
+	feed := &CapsuleFeed{URL: base.String()}
+	preformatted := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "```") {
+			preformatted = !preformatted
+			continue
+		}
+		switch {
+		case preformatted:
+		case feed.Title == "" && strings.HasPrefix(line, "# "):
+			feed.Title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "=>"):
+			target, label := linkLine(line)
+			match := gemfeedLink.FindStringSubmatch(label)
+			if match == nil {
+				continue
+			}
+			updated, err := time.Parse(time.DateOnly, match[1])
+			if err != nil {
+				continue
+			}
+			u, err := base.Parse(target)
+			if err != nil {
+				continue
+			}
+			title := match[2]
+			if title == "" {
+				title = match[1]
+			}
+			feed.Entries = append(feed.Entries, &CapsuleEntry{Title: title, URL: u.String(), Updated: updated})
+		}
+	}
+	if feed.Title == "" {
+		feed.Title = base.Host
+	}
+	slices.SortStableFunc(feed.Entries, func(a, b *CapsuleEntry) int {
+		return b.Updated.Compare(a.Updated)
+	})
+	return feed
+}
+
+// linkLine splits a gemtext link line in its URL and its label, which can be
+// empty
+func linkLine(line string) (target, label string) {
+	rest := strings.TrimSpace(strings.TrimPrefix(line, "=>"))
+	if i := strings.IndexAny(rest, " \t"); i >= 0 {
+		return rest[:i], strings.TrimSpace(rest[i+1:])
+	}
+	return rest, ""
+}
+
+// ParseAtom reads an Atom feed served over Gemini. Links are resolved
+// against base.
+func ParseAtom(data []byte, base *url.URL) (*CapsuleFeed, error) {
+	var atom atomFeed
+	if err := xml.Unmarshal(data, &atom); err != nil {
+		return nil, err
+	}
+
+	feed := &CapsuleFeed{Title: strings.TrimSpace(atom.Title), URL: base.String()}
+	if feed.Title == "" {
+		feed.Title = base.Host
+	}
+	for _, item := range atom.Entries {
+		entry := &CapsuleEntry{Title: strings.TrimSpace(item.Title)}
+		entry.Updated, _ = time.Parse(time.RFC3339, strings.TrimSpace(cmp.Or(item.Updated, item.Published)))
+		for _, link := range item.Links {
+			if link.Rel != "" && link.Rel != "alternate" {
+				continue
+			}
+			if u, err := base.Parse(strings.TrimSpace(link.Href)); err == nil {
+				entry.URL = u.String()
+				break
+			}
+		}
+		if entry.URL == "" {
+			// Without a link, it would have no ID in the feed Miniflux reads
+			continue
+		}
+		if text := cmp.Or(item.Content, item.Summary); text != nil {
+			entry.Content = text.html()
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed, nil
+}
+
+// html returns the text as HTML, which it is already unless its type is
+// text
+func (text *atomText) html() string {
+	if text.Type == "" || text.Type == "text" {
+		return "<p>" + html.EscapeString(strings.TrimSpace(text.Body)) + "</p>"
+	}
+	return text.Body
+}
+
+// GemtextToHTML converts gemtext to HTML, with links resolved against base
+func GemtextToHTML(text string, base *url.URL) string {
+	var out strings.Builder
+	preformatted, list := false, false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, "```") {
+			if preformatted {
+				out.WriteString("</pre>\n")
+			} else {
+				if list {
+					out.WriteString("</ul>\n")
+					list = false
+				}
+				out.WriteString("<pre>")
+			}
+			preformatted = !preformatted
+			continue
+		}
+		if preformatted {
+			out.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+
+		item := strings.HasPrefix(line, "* ")
+		if list && !item {
+			out.WriteString("</ul>\n")
+			list = false
+		}
+		switch {
+		case item:
+			if !list {
+				out.WriteString("<ul>\n")
+				list = true
+			}
+			out.WriteString("<li>" + html.EscapeString(strings.TrimSpace(line[2:])) + "</li>\n")
+		case strings.HasPrefix(line, "###"):
+			out.WriteString("<h3>" + html.EscapeString(strings.TrimSpace(line[3:])) + "</h3>\n")
+		case strings.HasPrefix(line, "##"):
+			out.WriteString("<h2>" + html.EscapeString(strings.TrimSpace(line[2:])) + "</h2>\n")
+		case strings.HasPrefix(line, "#"):
+			out.WriteString("<h1>" + html.EscapeString(strings.TrimSpace(line[1:])) + "</h1>\n")
+		case strings.HasPrefix(line, "=>"):
+			target, label := linkLine(line)
+			if target == "" {
+				continue
+			}
+			if u, err := base.Parse(target); err == nil {
+				target = u.String()
+			}
+			out.WriteString(`<p><a href="` + html.EscapeString(target) + `">` + html.EscapeString(cmp.Or(label, target)) + "</a></p>\n")
+		case strings.HasPrefix(line, ">"):
+			out.WriteString("<blockquote>" + html.EscapeString(strings.TrimSpace(line[1:])) + "</blockquote>\n")
+		case strings.TrimSpace(line) == "":
+		default:
+			out.WriteString("<p>" + html.EscapeString(line) + "</p>\n")
+		}
+	}
+	if list {
+		out.WriteString("</ul>\n")
+	}
+	if preformatted {
+		out.WriteString("</pre>\n")
+	}
+	return out.String()
+}
+
+// RenderAtom writes the feed as Atom, with the content of its entries as
+// HTML
+func (feed *CapsuleFeed) RenderAtom(w io.Writer) error {
+	var updated time.Time
+	for _, entry := range feed.Entries {
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	atom := atomFeed{
+		Title:   feed.Title,
+		ID:      feed.URL,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: feed.URL, Rel: "alternate", Type: "text/gemini"}},
+	}
+	for _, entry := range feed.Entries {
+		item := atomEntry{
+			Title:   entry.Title,
+			ID:      entry.URL,
+			Updated: entry.Updated.UTC().Format(time.RFC3339),
+			Author:  atomPerson{Name: feed.Title},
+			Links:   []atomLink{{Href: entry.URL, Rel: "alternate"}},
+		}
+		if entry.Content != "" {
+			item.Content = &atomText{Type: "html", Body: entry.Content}
+		}
+		atom.Entries = append(atom.Entries, item)
+	}
+	return writeAtom(w, atom)
+}
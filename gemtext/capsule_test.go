@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGemtextToHTML(t *testing.T) {
+	base, _ := url.Parse("gemini://example.com/gemlog/post.gmi")
+	tests := []struct {
+		gemtext string
+		want    string
+	}{
+		{"# Title\n## Part\n### Detail", "<h1>Title</h1>\n<h2>Part</h2>\n<h3>Detail</h3>\n"},
+		{"A <b> & c\r\n\r\nNext", "<p>A &lt;b&gt; &amp; c</p>\n<p>Next</p>\n"},
+		{"=> other.gmi Other\n=>\t/ ", "<p><a href=\"gemini://example.com/gemlog/other.gmi\">Other</a></p>\n<p><a href=\"gemini://example.com/\">gemini://example.com/</a></p>\n"},
+		{"* One\n* Two\nText", "<ul>\n<li>One</li>\n<li>Two</li>\n</ul>\n<p>Text</p>\n"},
+		{"> Quote", "<blockquote>Quote</blockquote>\n"},
+		{"```alt\n# Not a <heading>\n```", "<pre># Not a &lt;heading&gt;\n</pre>\n"},
+		{"* Item\n```\nunclosed", "<ul>\n<li>Item</li>\n</ul>\n<pre>unclosed\n</pre>\n"},
+	}
+	for _, tt := range tests {
+		if got := GemtextToHTML(tt.gemtext, base); got != tt.want {
+			t.Errorf("GemtextToHTML(%q) = %q, want %q", tt.gemtext, got, tt.want)
+		}
+	}
+}
+
+func TestParseGemfeed(t *testing.T) {
+	base, _ := url.Parse("gemini://example.com/gemlog/")
+	feed := ParseGemfeed("Intro\n```\n=> fake.gmi 2024-01-01 In a preformatted block\n```\n"+
+		"=> old.gmi 2023-12-31: Old\n=> new.gmi\t2024-02-01\n=> about.gmi About\n=> 2024-13-01.gmi 2024-13-01 Invalid date\n", base)
+
+	if feed.Title != "example.com" {
+		t.Errorf("title = %q, want the host without heading", feed.Title)
+	}
+	want := []CapsuleEntry{
+		{Title: "2024-02-01", URL: "gemini://example.com/gemlog/new.gmi", Updated: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{Title: "Old", URL: "gemini://example.com/gemlog/old.gmi", Updated: time.Date(2023, time.December, 31, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(feed.Entries) != len(want) {
+		t.Fatalf("entries = %d, want %d", len(feed.Entries), len(want))
+	}
+	for i, entry := range feed.Entries {
+		if *entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, *entry, want[i])
+		}
+	}
+}
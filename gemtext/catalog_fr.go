@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+var frenchCatalog = catalog{
+	// Home
+	"All Unread":                      "Tous les non lus",
+	"Starred":                         "Favoris",
+	"Refresh all":                     "Tout actualiser",
+	"Settings":                        "Réglages",
+	"Entries with the current filter": "Articles avec le filtre actuel",
+	"Subscribe to unread entries":     "S’abonner aux non lus",
+	"Subscribe to them":               "S’y abonner",
+	"Save this filter":                "Enregistrer ce filtre",
+	"Edit saved views":                "Modifier les vues enregistrées",
+	"Categories":                      "Catégories",
+	"Feeds":                           "Flux",
+	"None":                            "Aucun",
+	"No feeds":                        "Aucun flux",
+	"Help":                            "Aide",
+
+	// Entry
+	"min.":               "min.",
+	"Mark read":          "Marquer comme lu",
+	"Mark unread":        "Marquer comme non lu",
+	"Prev":               "Précédent",
+	"No Prev, stay here": "Pas de précédent, rester ici",
+	"Next":               "Suivant",
+	"Original page":      "Page d’origine",
+	"Comments":           "Commentaires",
+	"Fetch full article": "Récupérer l’article complet",
+	"Save":               "Sauvegarder",
+	"Stopped at %s":      "Arrêté à %s",
+	"Media of this feed": "Médias de ce flux",
+
+	// Media
+	"Media of %s":                "Médias de %s",
+	"Media":                      "Médias",
+	"Entry":                      "Article",
+	"No recent entry with media": "Aucun article récent avec des médias",
+	"B":                          "o",
+	"kB":                         "ko",
+	"MB":                         "Mo",
+	"GB":                         "Go",
+	"TB":                         "To",
+	"Page %d of %d":              "Page %d sur %d",
+	"Previous page":              "Page précédente",
+	"Continue reading":           "Continuer la lecture",
+
+	// Reader
+	"Subscribe to this site":     "S’abonner à ce site",
+	"Subscribe":                  "S’abonner",
+	"In %s":                      "Dans %s",
+	"No feed found on this page": "Aucun flux trouvé sur cette page",
+
+	// Subscription feed
+	"Starred entries of %s": "Favoris de %s",
+	"Starred entries":       "Favoris",
+	"Unread entries of %s":  "Non lus de %s",
+	"Unread entries":        "Non lus",
+	"No entries":            "Aucun article",
+	"Only the %d most recent entries were looked at for the tag": "Seuls les %d articles les plus récents ont été parcourus pour l’étiquette",
+
+	// History
+	"History":         "Historique",
+	"Reading history": "Historique de lecture",
+	"Read %s":         "Lu %s",
+	"No read entries": "Aucun article lu",
+	"Newer entries":   "Articles plus récents",
+	"Older entries":   "Articles plus anciens",
+
+	// Tags
+	"Tags":    "Étiquettes",
+	"No tags": "Aucune étiquette",
+	"Tags of the %d most recent entries, with their unread and total entries": "Étiquettes des %d articles les plus récents, avec leurs articles non lus et au total",
+
+	// Saved views
+	"Saved views":       "Vues enregistrées",
+	"No filter":         "Aucun filtre",
+	"Entries":           "Articles",
+	"Rename":            "Renommer",
+	"Change the filter": "Changer le filtre",
+	"Delete":            "Supprimer",
+	"No saved views. Open a category or a feed from the home page, then save its filter.": "Aucune vue enregistrée. Ouvrez une catégorie ou un flux depuis l’accueil, puis enregistrez son filtre.",
+	"Name of the view": "Nom de la vue",
+	"Filter of the view, as a query like feedID=1&starred=true": "Filtre de la vue, sous forme de requête comme feedID=1&starred=true",
+	"Type “%s” to delete the view %s":                           "Tapez « %s » pour supprimer la vue %s",
+	"yes":                                                       "oui",
+
+	// Settings
+	"Home":                              "Accueil",
+	"Order of entries":                  "Ordre des articles",
+	"Currently by %s, oldest first":     "Actuellement par %s, les plus anciens d’abord",
+	"Currently by %s, newest first":     "Actuellement par %s, les plus récents d’abord",
+	"By %s":                             "Par %s",
+	"Newest first":                      "Les plus récents d’abord",
+	"Oldest first":                      "Les plus anciens d’abord",
+	"Lists":                             "Listes",
+	"%d entries per page":               "%d articles par page",
+	"Change":                            "Modifier",
+	"Reading":                           "Lecture",
+	"Opening an entry marks it as read": "Ouvrir un article le marque comme lu",
+	"Following » Next marks the entry as read":                 "Suivre » Suivant marque l’article comme lu",
+	"Entries are only marked as read with ✓ Mark read":         "Les articles ne sont marqués comme lus qu’avec ✓ Marquer comme lu",
+	"Only mark entries as read with ✓ Mark read":               "Marquer les articles comme lus seulement avec ✓ Marquer comme lu",
+	"Mark entries as read when opening them":                   "Marquer les articles comme lus en les ouvrant",
+	"Mark entries as read when following » Next":               "Marquer les articles comme lus en suivant » Suivant",
+	"Feeds without unread entries are hidden on the home page": "Les flux sans article non lu sont cachés sur l’accueil",
+	"Show all feeds":                                 "Afficher tous les flux",
+	"All feeds are shown on the home page":           "Tous les flux sont affichés sur l’accueil",
+	"Hide feeds without unread entries":              "Cacher les flux sans article non lu",
+	"Long entries are split in pages of about %d kB": "Les longs articles sont découpés en pages d’environ %d ko",
+	"Long entries are shown in one page":             "Les longs articles sont affichés en une seule page",
+	"Dates":                                          "Dates",
+	"Dates look like %s, or %s in lists":             "Les dates ressemblent à %s, ou %s dans les listes",
+	"Change the format":                              "Modifier le format",
+	"Timezone: %s":                                   "Fuseau horaire : %s",
+	"Timezone: %s, from your Miniflux profile":       "Fuseau horaire : %s, celui de votre profil Miniflux",
+	"Change the timezone":                            "Modifier le fuseau horaire",
+	"Use the timezone of your Miniflux profile":      "Utiliser le fuseau horaire de votre profil Miniflux",
+	"Language":     "Langue",
+	"Language: %s": "Langue : %s",
+	"Language: %s, from your Miniflux profile":  "Langue : %s, celle de votre profil Miniflux",
+	"Use the language of your Miniflux profile": "Utiliser la langue de votre profil Miniflux",
+
+	// Content display
+	"Content display": "Affichage du contenu",
+	"For the feed %s. Options not set here are the ones of all feeds.": "Pour le flux %s. Les options non définies ici sont celles de tous les flux.",
+	"Display of all feeds": "Affichage de tous les flux",
+	"For all feeds. Each feed can override these options from its entries.": "Pour tous les flux. Chaque flux peut redéfinir ces options depuis ses articles.",
+	"Links":                                  "Liens",
+	"Numbered, with [1] markers in the text": "Numérotés, avec des renvois [1] dans le texte",
+	"Numbered":                               "Numérotés",
+	"Not numbered":                           "Non numérotés",
+	"No links":                               "Aucun lien",
+	"Reset":                                  "Réinitialiser",
+	"Lists of links every %d paragraphs":     "Listes de liens tous les %d paragraphes",
+	"Images":                                 "Images",
+	"As links":                               "Sous forme de liens",
+	"As their description":                   "Par leur description",
+	"Hidden":                                 "Cachées",
+	"Tables":                                 "Tableaux",
+	"One line per cell":                      "Une ligne par cellule",
+	"Drawn with ASCII art":                   "Dessinés en art ASCII",
+	"Headings":                               "Titres",
+	"Headings keep their level":              "Les titres gardent leur niveau",
+	"Headings are moved down by %d levels":   "Les titres sont abaissés de %d niveaux",
+	"Display of this feed":                   "Affichage de ce flux",
+	"Display of the content":                 "Affichage du contenu",
+	"Full article":                           "Article complet",
+	"Content of the feed":                    "Contenu du flux",
+	"Fetched from the original page, for feeds that only publish summaries": "Récupéré depuis la page d’origine, pour les flux qui ne publient que des résumés",
+	"Web links":                       "Liens vers le web",
+	"Opened directly":                 "Ouverts directement",
+	"Read here, converted to gemtext": "Lus ici, convertis en gemtext",
+
+	// Setting prompts
+	"Order entries by (%s)":                                    "Trier les articles par (%s)",
+	"Direction (asc or desc)":                                  "Sens (asc ou desc)",
+	"Entries per page (1 to %d)":                               "Articles par page (1 à %d)",
+	"Mark entries as read automatically (never, open or next)": "Marquer les articles comme lus automatiquement (never, open ou next)",
+	"true or false":                                            "true ou false",
+	"Split long entries in pages of about this many kB (%d to %d), 0 to never split them": "Découper les longs articles en pages d’environ ce nombre de ko (%d à %d), 0 pour ne jamais les découper",
+	"Date format, as a Go time layout like Jan. 02 2006":                                  "Format des dates, comme mise en page Go telle que Jan. 02 2006",
+	"Timezone, like Europe/Paris, or miniflux to use the one of your Miniflux profile":    "Fuseau horaire, comme Europe/Paris, ou miniflux pour celui de votre profil Miniflux",
+	"Language (%s), or miniflux to use the one of your Miniflux profile":                  "Langue (%s), ou miniflux pour celle de votre profil Miniflux",
+	"Links (%s)": "Liens (%s)",
+	"Paragraphs between lists of links (1 to %d)": "Paragraphes entre les listes de liens (1 à %d)",
+	"Images (%s)": "Images (%s)",
+	"Tables (%s)": "Tableaux (%s)",
+	"Levels to move headings down by (0 to %d)":                     "Niveaux dont abaisser les titres (0 à %d)",
+	"Fetch the full article from the original page (true or false)": "Récupérer l’article complet depuis la page d’origine (true ou false)",
+	"Web links (%s)": "Liens vers le web (%s)",
+
+	// Errors
+	"Unexpected error":          "Erreur inattendue",
+	"missing or invalid status": "statut manquant ou invalide",
+	"missing id":                "identifiant manquant",
+	"invalid id":                "identifiant invalide",
+	"No entry returned":         "Aucun article renvoyé",
+	"No entry returned among the %d most recent ones, which are the only ones looked at for tags": "Aucun article renvoyé parmi les %d plus récents, les seuls parcourus pour les étiquettes",
+	"Unknown setting":                         "Réglage inconnu",
+	"invalid value":                           "valeur invalide",
+	"Error saving settings":                   "Erreur à l’enregistrement des réglages",
+	"Not implemented":                         "Pas encore disponible",
+	"Certificate required, but none provided": "Certificat requis, mais aucun fourni",
+	"Unknown certificate, ask your admin to add yours: %q": "Certificat inconnu, demandez à votre admin d’ajouter le vôtre : %q",
+	"Internal Error": "Erreur interne",
+	"Miniflux refused your API token, it was likely revoked. Ask your admin to enroll your certificate again: %q": "Miniflux a refusé votre jeton d’API, il a sans doute été révoqué. Demandez à votre admin d’enregistrer à nouveau votre certificat : %q",
+	"Not found in Miniflux":            "Introuvable dans Miniflux",
+	"Miniflux is unreachable":          "Miniflux est injoignable",
+	"Error querying miniflux":          "Erreur en interrogeant Miniflux",
+	"Invalid or expired media link":    "Lien de média invalide ou expiré",
+	"The file is too large":            "Le fichier est trop gros",
+	"Files of this type aren’t served": "Les fichiers de ce type ne sont pas servis",
+	"Couldn’t get the file":            "Impossible de récupérer le fichier",
+	"URL of the web page to read":      "URL de la page web à lire",
+	"URL of the site to subscribe to":  "URL du site auquel s’abonner",
+	"invalid URL":                      "URL invalide",
+	"Only web pages can be read":       "Seules les pages web peuvent être lues",
+	"The page is too large":            "La page est trop grosse",
+	"Couldn’t get the page":            "Impossible de récupérer la page",
+	"invalid category":                 "catégorie invalide",
+	"No integration to save entries to is enabled in Miniflux, see Settings > Integrations there": "Aucune intégration pour sauvegarder les articles n’est activée dans Miniflux, voir Réglages > Intégrations là-bas",
+	"Error reading saved views":                   "Erreur à la lecture des vues enregistrées",
+	"Error saving the view":                       "Erreur à l’enregistrement de la vue",
+	"invalid filter":                              "filtre invalide",
+	"Unknown view":                                "Vue inconnue",
+	"Unknown action":                              "Action inconnue",
+	"Names must be a line of 1 to 100 characters": "Les noms doivent tenir sur une ligne de 1 à 100 caractères",
+
+	// Values refused by the settings
+	"unknown order %q":                           "ordre inconnu %q",
+	"unknown direction %q":                       "sens inconnu %q",
+	"page size must be between 1 and %d":         "le nombre d’articles par page doit être entre 1 et %d",
+	"expected never, open or next":               "never, open ou next attendu",
+	"expected true or false":                     "true ou false attendu",
+	"page length must be 0 or between %d and %d": "la longueur des pages doit être 0 ou entre %d et %d",
+	"invalid date format":                        "format de date invalide",
+	"unknown timezone %q":                        "fuseau horaire inconnu %q",
+	"unknown language %q":                        "langue inconnue %q",
+	"unknown setting %q":                         "réglage inconnu %q",
+	"expected one of %s":                         "une de ces valeurs attendue : %s",
+	"link frequency must be between 1 and %d":    "le nombre de paragraphes entre les listes de liens doit être entre 1 et %d",
+	"heading offset must be between 0 and %d":    "le décalage des titres doit être entre 0 et %d",
+	"unknown option %q":                          "option inconnue %q",
+}
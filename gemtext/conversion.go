@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/LukeEmmet/html2gemini"
+	miniflux "miniflux.app/client"
+)
+
+var (
+	//go:embed templates/conversion.gmi
+	conversionTxt string
+)
+
+// ConversionOptions control how the HTML content of entries is converted to
+// gemtext
+type ConversionOptions struct {
+	// How links are listed after paragraphs: citations, numbered, plain or
+	// none
+	Links string
+	// Paragraphs between lists of links
+	LinkFrequency int
+	// Images as links, as their alternative text, or none
+	Images string
+	// Tables drawn in ASCII art (pretty), or a line per cell (plain)
+	Tables string
+	// Levels headings of the content are moved down, so that they come
+	// under the title of the entry
+	HeadingOffset int
+	// Whether the full article is fetched from the original page, for feeds
+	// that only publish summaries
+	FullContent bool
+	// Whether links to web pages are opened directly, or read here as
+	// gemtext through the reader
+	WebLinks string
+}
+
+// Values of the options
+var (
+	linkStyles  = []string{"citations", "numbered", "plain", "none"}
+	imageStyles = []string{"links", "text", "none"}
+	tableStyles = []string{"plain", "pretty"}
+	webLinks    = []string{WebLinksDirect, WebLinksReader}
+)
+
+// ConversionKeys are the names of the options, in the order they are shown
+var ConversionKeys = []string{"links", "link_frequency", "images", "tables", "heading_offset", "full_content", "web_links"}
+
+// Gemtext only has 3 levels of headings
+const maxHeadingOffset = 2
+
+const maxLinkFrequency = 100
+
+// DefaultConversion is the server configuration, that users and feeds can
+// override
+var DefaultConversion = ConversionOptions{
+	Links:         "citations",
+	LinkFrequency: 2,
+	Images:        "links",
+	Tables:        "plain",
+	HeadingOffset: 0,
+	FullContent:   false,
+	WebLinks:      WebLinksDirect,
+}
+
+// Set parses and validates value, before assigning it to the option
+// designated by key
+func (o *ConversionOptions) Set(key, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "links":
+		if !slices.Contains(linkStyles, value) {
+			return invalidValue("expected one of %s", strings.Join(linkStyles, ", "))
+		}
+		o.Links = value
+	case "link_frequency":
+		frequency, err := strconv.Atoi(value)
+		if err != nil || frequency < 1 || frequency > maxLinkFrequency {
+			return invalidValue("link frequency must be between 1 and %d", maxLinkFrequency)
+		}
+		o.LinkFrequency = frequency
+	case "images":
+		if !slices.Contains(imageStyles, value) {
+			return invalidValue("expected one of %s", strings.Join(imageStyles, ", "))
+		}
+		o.Images = value
+	case "tables":
+		if !slices.Contains(tableStyles, value) {
+			return invalidValue("expected one of %s", strings.Join(tableStyles, ", "))
+		}
+		o.Tables = value
+	case "heading_offset":
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 || offset > maxHeadingOffset {
+			return invalidValue("heading offset must be between 0 and %d", maxHeadingOffset)
+		}
+		o.HeadingOffset = offset
+	case "full_content":
+		full, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalidValue("expected true or false")
+		}
+		o.FullContent = full
+	case "web_links":
+		if !slices.Contains(webLinks, value) {
+			return invalidValue("expected one of %s", strings.Join(webLinks, ", "))
+		}
+		o.WebLinks = value
+	default:
+		return invalidValue("unknown option %q", key)
+	}
+
+	return nil
+}
+
+// With returns the options with overrides applied, as saved by a user for
+// all feeds or for one of them
+func (o ConversionOptions) With(overrides url.Values) (ConversionOptions, error) {
+	for _, key := range ConversionKeys {
+		if !overrides.Has(key) {
+			continue
+		}
+		if err := o.Set(key, overrides.Get(key)); err != nil {
+			return o, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return o, nil
+}
+
+// ParseConversionOptions reads options like "links=plain,images=none" on
+// top of the default ones, for the server configuration
+func ParseConversionOptions(s string) (ConversionOptions, error) {
+	options := DefaultConversion
+	for _, option := range strings.Split(s, ",") {
+		if strings.TrimSpace(option) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return options, fmt.Errorf("expected key=value, got %q", option)
+		}
+		if err := options.Set(strings.TrimSpace(key), value); err != nil {
+			return options, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return options, nil
+}
+
+// ConversionPrompt returns the question asked to the user to get the value
+// of the option, in lang, and false if there is no such option
+func ConversionPrompt(key, lang string) (string, bool) {
+	switch key {
+	case "links":
+		return Translate(lang, "Links (%s)", strings.Join(linkStyles, ", ")), true
+	case "link_frequency":
+		return Translate(lang, "Paragraphs between lists of links (1 to %d)", maxLinkFrequency), true
+	case "images":
+		return Translate(lang, "Images (%s)", strings.Join(imageStyles, ", ")), true
+	case "tables":
+		return Translate(lang, "Tables (%s)", strings.Join(tableStyles, ", ")), true
+	case "heading_offset":
+		return Translate(lang, "Levels to move headings down by (0 to %d)", maxHeadingOffset), true
+	case "full_content":
+		return Translate(lang, "Fetch the full article from the original page (true or false)"), true
+	case "web_links":
+		return Translate(lang, "Web links (%s)", strings.Join(webLinks, ", ")), true
+	default:
+		return "", false
+	}
+}
+
+func (o *ConversionOptions) html2gemini() html2gemini.Options {
+	options := *html2gemini.NewOptions()
+	options.LinkEmitFrequency = o.LinkFrequency
+	options.OmitLinks = o.Links == "none"
+	if options.OmitLinks {
+		// Short paragraphs with a single link would still become link lines
+		options.ListItemToLinkWordThreshold = 0
+	}
+	options.CitationMarkers = o.Links == "citations"
+	options.NumberedLinks = o.Links == "citations" || o.Links == "numbered"
+	options.EmitImagesAsLinks = o.Images == "links"
+	// Tables are drawn by sanitizeHTML instead
+	options.PrettyTables = false
+	return options
+}
+
+// ConversionPage shows the conversion options, for all feeds or one of them,
+// with links to override them
+type ConversionPage struct {
+	ConversionOptions
+	// Options saved on this page, the others are inherited
+	Overrides url.Values
+	// Nil when showing the options for all feeds
+	Feed     *miniflux.Feed
+	settings Settings
+}
+
+func NewConversionPage(options ConversionOptions, overrides url.Values, feed *miniflux.Feed, settings Settings) *ConversionPage {
+	return &ConversionPage{
+		ConversionOptions: options,
+		Overrides:         overrides,
+		Feed:              feed,
+		settings:          settings,
+	}
+}
+
+// Path of the page, that option keys are added to
+func (page *ConversionPage) Path() string {
+	if page.Feed == nil {
+		return "/conversion/"
+	}
+	return fmt.Sprintf("/conversion/feed/%d/", page.Feed.ID)
+}
+
+// Overridden tells whether the option was set on this page
+func (page *ConversionPage) Overridden(key string) bool {
+	return page.Overrides.Has(key)
+}
+
+// Choice marks whether value is the current one of the option
+func (page *ConversionPage) Choice(key, value string) string {
+	if page.value(key) == value {
+		return "●"
+	}
+	return "○"
+}
+
+func (o *ConversionOptions) value(key string) string {
+	switch key {
+	case "links":
+		return o.Links
+	case "link_frequency":
+		return strconv.Itoa(o.LinkFrequency)
+	case "images":
+		return o.Images
+	case "tables":
+		return o.Tables
+	case "heading_offset":
+		return strconv.Itoa(o.HeadingOffset)
+	case "full_content":
+		return strconv.FormatBool(o.FullContent)
+	case "web_links":
+		return o.WebLinks
+	default:
+		return ""
+	}
+}
+
+func (page *ConversionPage) Render(w io.Writer) error {
+	return render(conversionTemplate, w, page.settings.Lang(), page)
+}
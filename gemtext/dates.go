@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type dateNames struct {
+	months, shortMonths [12]string
+	days, shortDays     [7]string
+}
+
+var namesByLanguage = map[string]dateNames{
+	"fr": {
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	"de": {
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So.", "Mo.", "Di.", "Mi.", "Do.", "Fr.", "Sa."},
+	},
+	"es": {
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene.", "feb.", "mar.", "abr.", "may.", "jun.", "jul.", "ago.", "sept.", "oct.", "nov.", "dic."},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom.", "lun.", "mar.", "mié.", "jue.", "vie.", "sáb."},
+	},
+}
+
+// Month and day names in Go layouts, longest first as "Jan" is a prefix of
+// "January"
+var nameTokens = []string{"January", "Monday", "Jan", "Mon"}
+
+// formatDate is like t.Format(layout), with month and day names in lang
+func formatDate(t time.Time, layout, lang string) string {
+	names, ok := namesByLanguage[lang]
+	if !ok {
+		return t.Format(layout)
+	}
+
+	var formatted strings.Builder
+	for layout != "" {
+		i, token := nextNameToken(layout)
+		if i < 0 {
+			formatted.WriteString(t.Format(layout))
+			break
+		}
+
+		formatted.WriteString(t.Format(layout[:i]))
+		var name, full string
+		switch token {
+		case "January":
+			name = names.months[t.Month()-1]
+		case "Jan":
+			name, full = names.shortMonths[t.Month()-1], names.months[t.Month()-1]
+		case "Monday":
+			name = names.days[t.Weekday()]
+		case "Mon":
+			name, full = names.shortDays[t.Weekday()], names.days[t.Weekday()]
+		}
+		formatted.WriteString(name)
+		layout = layout[i+len(token):]
+
+		// Layouts like "Jan. 02" mark English abbreviations with a period,
+		// which is already there or not needed in other languages
+		if full != "" && (strings.HasSuffix(name, ".") || name == full) {
+			layout = strings.TrimPrefix(layout, ".")
+		}
+	}
+	return formatted.String()
+}
+
+// nextNameToken returns the position of the first name token in layout, -1 if
+// there is none
+func nextNameToken(layout string) (int, string) {
+	first, firstToken := -1, ""
+	for _, token := range nameTokens {
+		i := strings.Index(layout, token)
+		if i >= 0 && (first < 0 || i < first) {
+			first, firstToken = i, token
+		}
+	}
+	return first, firstToken
+}
+
+// Units of relative dates, largest first
+var agoUnits = []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
+
+// For each language, how to say one and several of each of agoUnits, then
+// less than the smallest unit
+var agoPhrases = map[string][][2]string{
+	"en": {
+		{"a year ago", "%d years ago"},
+		{"a month ago", "%d months ago"},
+		{"a week ago", "%d weeks ago"},
+		{"yesterday", "%d days ago"},
+		{"an hour ago", "%d hours ago"},
+		{"a minute ago", "%d minutes ago"},
+		{"just now"},
+	},
+	"fr": {
+		{"il y a un an", "il y a %d ans"},
+		{"il y a un mois", "il y a %d mois"},
+		{"il y a une semaine", "il y a %d semaines"},
+		{"hier", "il y a %d jours"},
+		{"il y a une heure", "il y a %d heures"},
+		{"il y a une minute", "il y a %d minutes"},
+		{"à l’instant"},
+	},
+	"de": {
+		{"vor einem Jahr", "vor %d Jahren"},
+		{"vor einem Monat", "vor %d Monaten"},
+		{"vor einer Woche", "vor %d Wochen"},
+		{"gestern", "vor %d Tagen"},
+		{"vor einer Stunde", "vor %d Stunden"},
+		{"vor einer Minute", "vor %d Minuten"},
+		{"gerade eben"},
+	},
+	"es": {
+		{"hace un año", "hace %d años"},
+		{"hace un mes", "hace %d meses"},
+		{"hace una semana", "hace %d semanas"},
+		{"ayer", "hace %d días"},
+		{"hace una hora", "hace %d horas"},
+		{"hace un minuto", "hace %d minutos"},
+		{"ahora mismo"},
+	},
+}
+
+// ago describes how long before now t is, like “3 hours ago”, in lang
+func ago(t, now time.Time, lang string) string {
+	phrases, ok := agoPhrases[lang]
+	if !ok {
+		phrases = agoPhrases[DefaultLanguage]
+	}
+
+	elapsed := now.Sub(t)
+	for i, unit := range agoUnits {
+		switch n := int(elapsed / unit); {
+		case n == 1:
+			return phrases[i][0]
+		case n > 1:
+			return fmt.Sprintf(phrases[i][1], n)
+		}
+	}
+	return phrases[len(agoUnits)][0]
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	tests := []struct {
+		layout, lang, want string
+	}{
+		{"Jan. 02 2006", "en", "Mar. 14 2024"},
+		{"Jan. 02 2006", "fr", "mars 14 2024"},
+		{"Jan. 02 2006", "de", "März 14 2024"},
+		{"02 Jan. 2006", "fr", "14 mars 2024"},
+		{"Mon. Jan. 02", "es", "jue. mar. 14"},
+		{"Monday 2 January 2006 15:04", "fr", "jeudi 14 mars 2024 15:09"},
+		{"Mon 2 Jan", "de", "Do. 14 März"},
+		{"Mon. 2 Jan.", "en", "Thu. 14 Mar."},
+		{"January, Monday", "es", "marzo, jueves"},
+		{"2006-01-02 MST", "fr", "2024-03-14 UTC"},
+		{"January", "unknown", "March"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDate(fixtureDate, tt.layout, tt.lang); got != tt.want {
+			t.Errorf("formatDate(%q, %q) = %q, want %q", tt.layout, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestAgo(t *testing.T) {
+	tests := []struct {
+		elapsed time.Duration
+		lang    string
+		want    string
+	}{
+		{10 * time.Second, "en", "just now"},
+		{time.Minute, "en", "a minute ago"},
+		{3*time.Hour + 20*time.Minute, "en", "3 hours ago"},
+		{3 * time.Hour, "fr", "il y a 3 heures"},
+		{30 * time.Hour, "de", "gestern"},
+		{3 * 24 * time.Hour, "es", "hace 3 días"},
+		{400 * 24 * time.Hour, "unknown", "a year ago"},
+	}
+
+	for _, tt := range tests {
+		if got := ago(fixtureDate.Add(-tt.elapsed), fixtureDate, tt.lang); got != tt.want {
+			t.Errorf("ago(%v, %q) = %q, want %q", tt.elapsed, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestAgoDefaultLanguage(t *testing.T) {
+	defer func(lang string) { DefaultLanguage = lang }(DefaultLanguage)
+	DefaultLanguage = "fr"
+	if got, want := ago(fixtureDate.Add(-3*time.Hour), fixtureDate, "unknown"), "il y a 3 heures"; got != want {
+		t.Errorf("ago in an unknown language = %q, want %q in the default one", got, want)
+	}
+}
+
+func TestWithProfile(t *testing.T) {
+	settings := DefaultSettings().WithProfile("Europe/Paris", "fr_FR")
+	if settings.Timezone != "Europe/Paris" || settings.Language != "fr" {
+		t.Errorf("profile not applied: %+v", settings)
+	}
+
+	chosen := DefaultSettings()
+	chosen.Timezone, chosen.Language = "Asia/Tokyo", "de"
+	settings = chosen.WithProfile("Europe/Paris", "fr_FR")
+	if settings.Timezone != "Asia/Tokyo" || settings.Language != "de" {
+		t.Errorf("profile overrode chosen settings: %+v", settings)
+	}
+
+	settings = DefaultSettings().WithProfile("", "zh_CN")
+	if settings.Language != "" || settings.Lang() != "en" {
+		t.Errorf("unsupported language %q used", settings.Language)
+	}
+}
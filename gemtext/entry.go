@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/url"
+	"time"
 
 	"github.com/LukeEmmet/html2gemini"
 	miniflux "miniflux.app/client"
@@ -29,45 +30,160 @@ import (
 
 var (
 	//go:embed templates/entry.gmi
-	entryTxt  string
-	entryTmpl = geminiTemplate("entry", entryTxt)
+	entryTxt string
 )
 
 type TemplatableEntry struct {
 	*miniflux.Entry
+	// Content of the current page, converted to gemtext
 	GeminiContent string
-	query         *url.Values
+	// Current page, from 1
+	Page int
+	// Whether the content was fetched from the original page, rather than
+	// being the one of the feed
+	Full bool
+	// Position reached in the enclosures, in seconds, by enclosure ID
+	MediaProgressions map[int64]int
+	pages             []string
+	query             *url.Values
+	settings          Settings
 }
 
-func NewTemplatableEntry(minifluxEntry *miniflux.Entry, query *url.Values) (*TemplatableEntry, error) {
+// NewTemplatableEntry converts the entry and keeps the given page of it, if
+// the user splits long entries in pages
+func NewTemplatableEntry(minifluxEntry *miniflux.Entry, query *url.Values, page int, settings Settings) (*TemplatableEntry, error) {
 	if minifluxEntry == nil || query == nil {
 		return nil, fmt.Errorf("error trying to render nil entry")
 	}
-	gemini, err := htmlToGemini(minifluxEntry.Content)
+	gemini, err := convert(minifluxEntry.Content, settings.Conversion)
 	if err != nil {
 		return nil, fmt.Errorf("error converting gemini to HTML for entry %d: %w", minifluxEntry.ID, err)
 	}
 
+	pages := splitPages(gemini, settings.PageLength*1000)
+	page = min(max(page, 1), len(pages))
+
 	return &TemplatableEntry{
 		Entry:         minifluxEntry,
-		GeminiContent: gemini,
+		GeminiContent: pages[page-1],
+		Page:          page,
+		pages:         pages,
 		query:         query,
+		settings:      settings,
 	}, nil
 }
 
+// Attachments returns the enclosures of the entry
+func (entry *TemplatableEntry) Attachments() []*Enclosure {
+	return enclosures(entry.Enclosures, entry.MediaProgressions, entry.settings.Lang())
+}
+
+// PageCount returns the number of pages of the entry
+func (entry *TemplatableEntry) PageCount() int {
+	return len(entry.pages)
+}
+
+// Headings returns the table of contents of an entry with several pages
+func (entry *TemplatableEntry) Headings() []Heading {
+	if len(entry.pages) < 2 {
+		return nil
+	}
+	return pageHeadings(entry.pages)
+}
+
+// PageParams returns the parameters to get the given page of the entry
+func (entry *TemplatableEntry) PageParams(page int) string {
+	query := entry.sameEntry()
+	query.Set("page", fmt.Sprint(page))
+	return query.Encode()
+}
+
+// FullParams returns the parameters to get the entry with the full article
+// fetched from the original page
+func (entry *TemplatableEntry) FullParams() string {
+	query := entry.sameEntry()
+	query.Set("full", "true")
+	return query.Encode()
+}
+
+// sameEntry returns the parameters to get the entry again, with the same
+// content. They point to the entry itself, as it may not be at the same
+// offset in the list any more
+func (entry *TemplatableEntry) sameEntry() url.Values {
+	query := copyQuery(entry.query)
+	query.Set("entryID", fmt.Sprint(entry.ID))
+	if entry.Full {
+		query.Set("full", "true")
+	}
+	return query
+}
+
+// PrevPage returns the parameters to get the previous page of the entry, or
+// "" on the first one
+func (entry *TemplatableEntry) PrevPage() string {
+	if entry.Page <= 1 {
+		return ""
+	}
+	return entry.PageParams(entry.Page - 1)
+}
+
+// NextPage returns the parameters to get the next page of the entry, or "" on
+// the last one
+func (entry *TemplatableEntry) NextPage() string {
+	if entry.Page >= len(entry.pages) {
+		return ""
+	}
+	return entry.PageParams(entry.Page + 1)
+}
+
+// TagParams returns the parameters of the article list of the entries with
+// the tag
+func (entry *TemplatableEntry) TagParams(tag string) string {
+	return url.Values{"tag": {tag}}.Encode()
+}
+
+// Published returns the publication date, formatted as the user prefers
+func (entry *TemplatableEntry) Published() string {
+	return entry.settings.FormatDate(entry.Date)
+}
+
 // Render renders the entry with the gemini template
 func (entry *TemplatableEntry) Render(w io.Writer) error {
-	return entryTmpl.Execute(w, entry)
+	return render(entryTemplate, w, entry.settings.Lang(), entry)
 }
 
 // Next returns the parameters to get the next entry in the reading list
 func (entry *TemplatableEntry) Next() string {
 	query := copyQuery(entry.query)
 	query.Del("offset") // There may already be an offset stored, we want to replace it
-	query.Set("offset", fmt.Sprint(currentOffset(entry.query)+1))
+	query.Set("offset", fmt.Sprint(entry.nextOffset(entry.Status)))
+	return query.Encode()
+}
+
+// ReadNext returns the parameters to mark the entry as read and get the next
+// entry in the reading list, or "" if following Next shouldn’t mark the entry
+func (entry *TemplatableEntry) ReadNext() string {
+	if entry.settings.AutoMarkRead != AutoMarkReadNext || entry.Status != miniflux.EntryStatusUnread {
+		return ""
+	}
+
+	query := copyQuery(entry.query)
+	query.Set("_id", fmt.Sprint(entry.ID))
+	query.Set("offset", fmt.Sprint(entry.nextOffset(miniflux.EntryStatusRead)))
 	return query.Encode()
 }
 
+// nextOffset returns the offset of the next entry, once this entry has the
+// given status. An entry marked as read leaves a list of unread entries, so
+// the next one takes its offset
+func (entry *TemplatableEntry) nextOffset(status string) int {
+	offset := currentOffset(entry.query)
+	if status != miniflux.EntryStatusUnread && unreadOnly(entry.query) {
+		return offset
+	}
+	return offset + 1
+}
+
 // Prev returns the parameters to get the previous entry in the reading list
 func (entry *TemplatableEntry) Prev() string {
 	offset := currentOffset(entry.query)
@@ -86,11 +202,28 @@ func (entry *TemplatableEntry) Params(key_values ...string) (string, error) {
 	return params(entry.query, key_values...)
 }
 
-func htmlToGemini(html string) (gemini string, err error) {
-	opts := html2gemini.NewOptions()
-	// TODO Customize options
-	ctx := html2gemini.NewTraverseContext(*opts)
+// ObserveConversion is called with the time taken by each HTML to gemtext
+// conversion, for metrics, when it is set
+var ObserveConversion func(time.Duration)
+
+// convert converts HTML to gemtext with the conversion options, and reports
+// the time it took to ObserveConversion
+func convert(html string, options ConversionOptions) (string, error) {
+	start := time.Now()
+	gemini, err := htmlToGemini(html, options)
+	if ObserveConversion != nil {
+		ObserveConversion(time.Since(start))
+	}
+	return gemini, err
+}
+
+func htmlToGemini(html string, options ConversionOptions) (gemini string, err error) {
+	html, err = sanitizeHTML(html, options)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := html2gemini.NewTraverseContext(options.html2gemini())
 
 	return html2gemini.FromString(html, *ctx)
 }
-
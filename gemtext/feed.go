@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+var (
+	//go:embed templates/feed.gmi
+	feedTxt string
+)
+
+// EntryFeed lists entries for the feed readers of Gemini clients, as a
+// gemtext page following the “Subscribing to Gemini pages” convention, or as
+// Atom
+type EntryFeed struct {
+	// The Miniflux feed or category the entries are filtered on, if any
+	Feed     *miniflux.Feed
+	Category *miniflux.Category
+	Starred  bool
+	Entries  miniflux.Entries
+	// Entries looked at for the tag of the filter, when there were more
+	ScanLimit int
+	// Absolute URL of the page, that links are resolved against in Atom
+	base     *url.URL
+	settings Settings
+}
+
+func NewEntryFeed(entries miniflux.Entries, feed *miniflux.Feed, category *miniflux.Category, starred bool, base *url.URL, settings Settings) *EntryFeed {
+	return &EntryFeed{
+		Feed:     feed,
+		Category: category,
+		Starred:  starred,
+		Entries:  entries,
+		base:     base,
+		settings: settings,
+	}
+}
+
+// Title names the entries after the filter
+func (feed *EntryFeed) Title() string {
+	lang := feed.settings.Lang()
+	var name string
+	switch {
+	case feed.Feed != nil:
+		name = feed.Feed.Title
+	case feed.Category != nil:
+		name = feed.Category.Title
+	}
+	switch {
+	case feed.Starred && name != "":
+		return Translate(lang, "Starred entries of %s", name)
+	case feed.Starred:
+		return Translate(lang, "Starred entries")
+	case name != "":
+		return Translate(lang, "Unread entries of %s", name)
+	default:
+		return Translate(lang, "Unread entries")
+	}
+}
+
+// Permalink returns the link to the entry, which doesn’t depend on its
+// position in a list
+func (feed *EntryFeed) Permalink(entry *miniflux.Entry) string {
+	return fmt.Sprintf("/entry?entryID=%d", entry.ID)
+}
+
+// Day formats the publication date of the entry as the convention expects
+func (feed *EntryFeed) Day(entry *miniflux.Entry) string {
+	return entry.Date.In(feed.settings.Location()).Format(time.DateOnly)
+}
+
+func (feed *EntryFeed) Render(w io.Writer) error {
+	return render(feedTemplate, w, feed.settings.Lang(), feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published,omitempty"`
+	Updated   string     `xml:"updated"`
+	Author    atomPerson `xml:"author"`
+	Links     []atomLink `xml:"link"`
+	Category  *atomTerm  `xml:"category"`
+	Summary   *atomText  `xml:"summary"`
+	Content   *atomText  `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomTerm struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+// RenderAtom writes the entries as an Atom feed, linking to their Gemini
+// permalinks and original pages
+func (feed *EntryFeed) RenderAtom(w io.Writer) error {
+	// The time of the latest entry, so that the feed doesn’t look updated
+	// when nothing changed
+	var updated time.Time
+	for _, entry := range feed.Entries {
+		if entry.Date.After(updated) {
+			updated = entry.Date
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	atom := atomFeed{
+		Title:   feed.Title(),
+		ID:      feed.base.String(),
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links:   []atomLink{{Href: feed.base.String(), Rel: "self", Type: "application/atom+xml"}},
+	}
+	for _, entry := range feed.Entries {
+		permalink := feed.base.ResolveReference(&url.URL{Path: "/entry", RawQuery: fmt.Sprintf("entryID=%d", entry.ID)}).String()
+		item := atomEntry{
+			Title:     entry.Title,
+			ID:        permalink,
+			Published: entry.Date.UTC().Format(time.RFC3339),
+			Updated:   entry.Date.UTC().Format(time.RFC3339),
+			Author:    atomPerson{Name: entry.Author},
+			Links:     []atomLink{{Href: permalink, Rel: "alternate", Type: "text/gemini"}},
+		}
+		if entry.URL != "" {
+			item.Links = append(item.Links, atomLink{Href: entry.URL, Rel: "related"})
+		}
+		if entry.Feed != nil {
+			if item.Author.Name == "" {
+				item.Author.Name = entry.Feed.Title
+			}
+			if entry.Feed.Category != nil {
+				item.Category = &atomTerm{Term: entry.Feed.Category.Title}
+			}
+		}
+		atom.Entries = append(atom.Entries, item)
+	}
+
+	return writeAtom(w, atom)
+}
+
+func writeAtom(w io.Writer, atom atomFeed) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(atom); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	miniflux "miniflux.app/client"
+)
+
+func FuzzCopyQuery(f *testing.F) {
+	f.Add("offset=1&feedID=10&statuses=unread&statuses=read")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		values, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return
+		}
+		original := copyQuery(&values)
+
+		query := copyQuery(&values)
+		if !reflect.DeepEqual(query, values) {
+			t.Fatalf("copy %v differs from %v", query, values)
+		}
+		query.Set("offset", "42")
+		query.Del("feedID")
+		if !reflect.DeepEqual(original, values) {
+			t.Fatalf("changing the copy changed the original: %v, was %v", values, original)
+		}
+	})
+}
+
+func FuzzParams(f *testing.F) {
+	f.Add("offset=1&feedID=10", "offset", "2")
+	f.Add("", "_status", "read")
+	f.Add("search=a%0Ab", "search", "line\r\nbreak")
+	f.Fuzz(func(t *testing.T, rawQuery, key, value string) {
+		values, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return
+		}
+		original := copyQuery(&values)
+
+		encoded, err := params(&values, key, value)
+		if err != nil {
+			t.Fatalf("params: %v", err)
+		}
+		if strings.ContainsAny(encoded, "\r\n ") {
+			t.Fatalf("params %q would break a link line", encoded)
+		}
+		if !reflect.DeepEqual(original, values) {
+			t.Fatalf("params changed its input: %v, was %v", values, original)
+		}
+
+		decoded, err := url.ParseQuery(encoded)
+		if err != nil {
+			t.Fatalf("params %q can’t be parsed back: %v", encoded, err)
+		}
+		if got := decoded[key]; len(got) != 1 || got[0] != value {
+			t.Fatalf("%q = %q after round trip, want %q", key, got, value)
+		}
+		for k, v := range values {
+			if k != key && !reflect.DeepEqual(decoded[k], v) {
+				t.Fatalf("%q = %q after round trip, want %q", k, decoded[k], v)
+			}
+		}
+
+		if _, err := params(&values, key); err == nil {
+			t.Fatalf("params accepted an odd number of arguments")
+		}
+	})
+}
+
+func FuzzHTMLToGemini(f *testing.F) {
+	f.Add(`<p>Hello <a href="https://example.com">world</a></p>`, "https://example.com", "world", uint8(0))
+	f.Add("<pre>```\n=> /evil</pre>", "https://a\nb", "x\n=> /evil", uint8(5))
+	f.Add(`<img src="a.png" alt="an image">`, "/relative path", "", uint8(2))
+	f.Add(`<table><tr><td>a<table><tr><td>b</td></tr></table></td></tr></table>`, "", "", uint8(7))
+	f.Fuzz(func(t *testing.T, content, href, label string, style uint8) {
+		// Each bit picks a different option, to cover their combinations
+		options := DefaultConversion
+		options.Links = linkStyles[int(style)%len(linkStyles)]
+		options.Images = imageStyles[int(style>>2)%len(imageStyles)]
+		options.Tables = tableStyles[int(style>>3)%len(tableStyles)]
+		options.HeadingOffset = int(style>>4) % (maxHeadingOffset + 1)
+
+		// Must not panic, the result is hard to check for arbitrary HTML
+		htmlToGemini(content, options)
+
+		// With the rest of the document under control, a single link must
+		// give a single link line
+		link := `<p><a href="` + html.EscapeString(href) + `">` + html.EscapeString(label) + `</a></p>`
+		gemini, err := htmlToGemini(link, options)
+		if err != nil {
+			return
+		}
+		if n := countLinkLines(gemini); n > 1 {
+			t.Fatalf("%d link lines for a single link:\n%s", n, gemini)
+		}
+	})
+}
+
+func FuzzEntryLinks(f *testing.F) {
+	f.Add("https://blog.example/first", "https://forum.example/first", "First post", "Alice", "offset=2&feedID=10")
+	f.Add("https://a\n=> /evil", "\r\n", "Title\n=> /evil", "Bob\n# Heading", "search=%0A")
+	f.Fuzz(func(t *testing.T, link, commentsURL, title, author, rawQuery string) {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return
+		}
+
+		entry := fixtureEntry()
+		entry.Content = ""
+		entry.URL, entry.CommentsURL, entry.Title, entry.Author = link, commentsURL, title, author
+		got := renderEntry(t, entry, query)
+
+		// Same entry with harmless values, rendering the same branches
+		placeholder := func(s string) string {
+			if s == "" {
+				return ""
+			}
+			return "x"
+		}
+		entry = fixtureEntry()
+		entry.Content = ""
+		entry.URL, entry.CommentsURL, entry.Title, entry.Author =
+			placeholder(link), placeholder(commentsURL), placeholder(title), placeholder(author)
+		want := renderEntry(t, entry, url.Values{"offset": query["offset"]})
+
+		if strings.Count(got, "\n") != strings.Count(want, "\n") {
+			t.Fatalf("injected lines:\n%s\nshould have the shape of:\n%s", got, want)
+		}
+	})
+}
+
+func FuzzSplitPages(f *testing.F) {
+	f.Add("# One\naaaa\n\n## Two\nbbbb\n", 20)
+	f.Add("text\n```\n# not a heading\n```\nend", 5)
+	f.Add("000\n\n0\n0\n0", 3)
+	f.Fuzz(func(t *testing.T, content string, maxLength int) {
+		pages := splitPages(content, maxLength)
+		if len(pages) == 0 {
+			t.Fatalf("no page for %q", content)
+		}
+
+		// Only blank lines at the end of pages may be removed
+		if got, want := nonBlankLines(strings.Join(pages, "")), nonBlankLines(content); !reflect.DeepEqual(got, want) {
+			t.Fatalf("pages %q don’t have the lines of %q", pages, content)
+		}
+		for i, page := range pages[:len(pages)-1] {
+			fences := strings.Count("\n"+page, "\n```")
+			if fences%2 != 0 {
+				t.Fatalf("page %d of %q splits a preformatted block", i, pages)
+			}
+			if len(page) > maxLength && fences == 0 && strings.Count(page, "\n") > 1 {
+				t.Fatalf("page %q is longer than %d", page, maxLength)
+			}
+		}
+	})
+}
+
+func nonBlankLines(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return r == '\n' })
+}
+
+func renderEntry(t *testing.T, entry *miniflux.Entry, query url.Values) string {
+	t.Helper()
+	templatable, err := NewTemplatableEntry(entry, &query, 1, DefaultSettings())
+	if err != nil {
+		t.Fatalf("NewTemplatableEntry: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := templatable.Render(&buf); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	return buf.String()
+}
+
+func countLinkLines(text string) int {
+	n := 0
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "=>") {
+			n++
+		}
+	}
+	return n
+}
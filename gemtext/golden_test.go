@@ -0,0 +1,424 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var (
+	fixtureTech = &miniflux.Category{ID: 1, Title: "Tech"}
+	fixtureMisc = &miniflux.Category{ID: 2, Title: "Misc"}
+	fixtureFeed = &miniflux.Feed{ID: 10, Title: "A blog", Category: fixtureTech}
+	fixtureDate = time.Date(2024, time.March, 14, 15, 9, 26, 0, time.UTC)
+)
+
+func fixtureEntry() *miniflux.Entry {
+	return &miniflux.Entry{
+		ID:          100,
+		FeedID:      fixtureFeed.ID,
+		Feed:        fixtureFeed,
+		Status:      miniflux.EntryStatusUnread,
+		Title:       "First post",
+		URL:         "https://blog.example/first",
+		CommentsURL: "https://forum.example/first",
+		Date:        fixtureDate,
+		Author:      "Alice",
+		Starred:     true,
+		ReadingTime: 4,
+		Content: `<h2>Intro</h2><p>Hello <a href="https://example.com">world</a>.</p>` +
+			`<ul><li>one</li><li>two</li></ul><blockquote>Quoted</blockquote>`,
+	}
+}
+
+var fixtureEnclosures = miniflux.Enclosures{
+	{ID: 1, URL: "https://blog.example/episode%201.mp3", MimeType: "audio/mpeg", Size: 48_300_000},
+	{ID: 2, URL: "https://blog.example/cover.jpg", MimeType: "image/jpeg", Size: 812},
+	{ID: 3, URL: "https://blog.example/notes", MimeType: "", Size: 0},
+}
+
+// A web page with navigation around its article, and relative links
+const fixturePage = `<html><head><title>A
+web page</title></head><body>
+<header><a href="/">Site</a></header>
+<article><h1>Article</h1><p>Some text with <a href="other.html">a link</a>.</p>
+<img src="/image.png" alt="An image"><script>alert(1)</script></article>
+<footer>Copyright</footer></body></html>`
+
+// checkGolden compares got with testdata/name, or overwrites the latter with
+// -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("updating %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s (use -update to create it): %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the rendered output (use -update if expected), got:\n%s", path, got)
+	}
+}
+
+// Characters of URLs, others must be percent-encoded
+const urlCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-._~:/?#[]@!$&'()*+,;=%"
+
+// malformedLines returns a description of each malformed link line in text
+func malformedLines(text string) []string {
+	var malformed []string
+	preformatted := false
+	for i, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "```") {
+			preformatted = !preformatted
+			continue
+		}
+		if preformatted || !strings.HasPrefix(line, "=>") {
+			continue
+		}
+
+		if err := checkLinkURL(linkTarget(line)); err != nil {
+			malformed = append(malformed, fmt.Sprintf("line %d: %v: %q", i+1, err, line))
+		}
+	}
+	return malformed
+}
+
+// linkTarget returns the URL of a link line, up to the first whitespace
+func linkTarget(line string) string {
+	target := strings.TrimLeft(strings.TrimPrefix(line, "=>"), " \t")
+	if i := strings.IndexAny(target, " \t"); i >= 0 {
+		target = target[:i]
+	}
+	return target
+}
+
+// checkLinkURL tells why target isn’t a valid URL for a link line
+func checkLinkURL(target string) error {
+	if target == "" {
+		return fmt.Errorf("link without URL")
+	}
+	for _, r := range target {
+		if !strings.ContainsRune(urlCharacters, r) {
+			return fmt.Errorf("unescaped %q in link URL", r)
+		}
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid link URL: %w", err)
+	}
+	if _, err := url.ParseQuery(u.RawQuery); err != nil {
+		return fmt.Errorf("invalid query in link URL: %w", err)
+	}
+	return nil
+}
+
+// validateGemtext fails the test on malformed link lines
+func validateGemtext(t *testing.T, text string) {
+	t.Helper()
+	for _, malformed := range malformedLines(text) {
+		t.Error(malformed)
+	}
+}
+
+// renderer is a page rendered to a golden file
+type renderer interface {
+	Render(w io.Writer) error
+}
+
+// settingsWith returns the default settings, after change
+func settingsWith(change func(s *Settings)) Settings {
+	settings := DefaultSettings()
+	change(&settings)
+	return settings
+}
+
+func homePage(t *testing.T, categories miniflux.Categories, feeds miniflux.Feeds, query url.Values, views []*SavedView, language string) *Home {
+	t.Helper()
+	home, err := NewHome(&categories, &feeds, &query, settingsWith(func(s *Settings) { s.Language = language }))
+	if err != nil {
+		t.Fatalf("NewHome: %v", err)
+	}
+	home.Views = views
+	return home
+}
+
+// entryPage renders the fixture entry, after change
+func entryPage(t *testing.T, change func(e *miniflux.Entry), query url.Values, page int, settings Settings, progressions map[int64]int) *TemplatableEntry {
+	t.Helper()
+	entry := fixtureEntry()
+	change(entry)
+	templatable, err := NewTemplatableEntry(entry, &query, page, settings)
+	if err != nil {
+		t.Fatalf("NewTemplatableEntry: %v", err)
+	}
+	templatable.MediaProgressions = progressions
+	return templatable
+}
+
+// settingsPage shows settings with the timezone and language of the Miniflux
+// profile
+func settingsPage(settings Settings, timezone, language string) *SettingsPage {
+	return &SettingsPage{
+		Settings:  settings,
+		Effective: settings.WithProfile(timezone, language),
+		Now:       fixtureDate,
+	}
+}
+
+func mediaPage(feed *miniflux.Feed, settings Settings, count int) *MediaPage {
+	var entries miniflux.Entries
+	for i := range count {
+		entry := fixtureEntry()
+		entry.ID += int64(i)
+		entry.Enclosures = fixtureEnclosures
+		// Entries without enclosures aren’t listed
+		entries = append(entries, entry, fixtureEntry())
+	}
+	page := NewMediaPage(entries, feed, settings)
+	page.now = fixtureDate.Add(3 * time.Hour)
+	return page
+}
+
+func readerPage(t *testing.T, settings Settings) *ReaderPage {
+	t.Helper()
+	page, err := NewReaderPage("https://example.com/blog/page.html", fixturePage, settings)
+	if err != nil {
+		t.Fatalf("NewReaderPage: %v", err)
+	}
+	return page
+}
+
+// feedPage lists entries published late in the day in UTC, but the next day
+// in Paris
+func feedPage(feed *miniflux.Feed, starred bool, settings Settings, count, scanLimit int) *EntryFeed {
+	var entries miniflux.Entries
+	for i := range count {
+		entry := fixtureEntry()
+		entry.ID += int64(i)
+		entry.Date = time.Date(2024, time.March, 14-i, 23, 30, 0, 0, time.UTC)
+		entries = append(entries, entry)
+	}
+	base := &url.URL{Scheme: "gemini", Host: "example.com", Path: "/feed.gmi"}
+	page := NewEntryFeed(entries, feed, nil, starred, base, settings)
+	page.ScanLimit = scanLimit
+	return page
+}
+
+func historyPage(settings Settings, count, total, offset int) *HistoryPage {
+	var entries miniflux.Entries
+	for i := range count {
+		entry := fixtureEntry()
+		entry.ID += int64(i)
+		entry.Status = miniflux.EntryStatusRead
+		entry.ChangedAt = fixtureDate.Add(-time.Duration(i+1) * 3 * time.Hour)
+		entries = append(entries, entry)
+	}
+	page := NewHistoryPage(entries, total, offset, settings)
+	page.now = fixtureDate
+	return page
+}
+
+func TestGolden(t *testing.T) {
+	french := settingsWith(func(s *Settings) { s.Language = "fr" })
+	readNext := settingsWith(func(s *Settings) { s.AutoMarkRead = AutoMarkReadNext })
+	paged := settingsWith(func(s *Settings) { s.PageLength = 2 })
+	longContent := func(e *miniflux.Entry) {
+		paragraph := "<p>" + strings.Repeat("All work and no play makes Jack a dull boy. ", 10) + "</p>"
+		e.Content = "<h2>Morning</h2>" + strings.Repeat(paragraph, 3) +
+			"<h2>Evening</h2>" + strings.Repeat(paragraph, 3) +
+			"<h2>Night</h2>" + paragraph
+	}
+	views := []*SavedView{
+		{ID: 1, Name: "Blog", Filter: url.Values{"feedID": {"10"}}},
+		{ID: 2, Name: "Everything", Filter: url.Values{}},
+	}
+	readTagged := fixtureEntry()
+	readTagged.ID, readTagged.Status, readTagged.Tags = 101, miniflux.EntryStatusRead, []string{"go ", "Archive"}
+	unreadTagged := fixtureEntry()
+	unreadTagged.Tags = []string{"Go", "News", "go"}
+	tagged := miniflux.Entries{unreadTagged, readTagged}
+
+	tests := []struct {
+		name string
+		page renderer
+	}{
+		{"home.gmi", homePage(t,
+			miniflux.Categories{fixtureTech, fixtureMisc},
+			miniflux.Feeds{fixtureFeed, {ID: 11, Title: "Another blog", Category: fixtureTech}},
+			url.Values{}, nil, "")},
+		{"home_filter.gmi", homePage(t,
+			miniflux.Categories{fixtureTech}, miniflux.Feeds{fixtureFeed},
+			url.Values{"feedID": {"10"}, "status": {"read"}}, nil, "")},
+		{"home_views.gmi", homePage(t,
+			miniflux.Categories{fixtureTech}, miniflux.Feeds{fixtureFeed}, url.Values{},
+			[]*SavedView{
+				{ID: 1, Name: "Blog", Filter: url.Values{"feedID": {"10"}}, Unread: 3},
+				{ID: 2, Name: "Starred", Filter: url.Values{"starred": {"true"}, "status": {"read"}}},
+				{ID: 3, Name: "Go", Filter: url.Values{"tag": {"Go"}}, Unread: 100, MoreUnread: true},
+			}, "")},
+		{"home_empty.gmi", homePage(t, miniflux.Categories{}, miniflux.Feeds{}, url.Values{}, nil, "")},
+		{"home_fr.gmi", homePage(t,
+			miniflux.Categories{fixtureTech}, miniflux.Feeds{fixtureFeed},
+			url.Values{"feedID": {"10"}}, nil, "fr")},
+
+		{"entry.gmi", entryPage(t, func(*miniflux.Entry) {}, url.Values{"offset": {"2"}, "feedID": {"10"}}, 0, DefaultSettings(), nil)},
+		{"entry_read.gmi", entryPage(t, func(e *miniflux.Entry) {
+			e.Status = miniflux.EntryStatusRead
+			e.Starred = false
+		}, url.Values{"offset": {"1"}}, 0, DefaultSettings(), nil)},
+		{"entry_tags.gmi", entryPage(t, func(e *miniflux.Entry) {
+			e.Tags = []string{"Go", "open source"}
+		}, url.Values{"tag": {"Go"}}, 0, DefaultSettings(), nil)},
+		{"entry_minimal.gmi", entryPage(t, func(e *miniflux.Entry) {
+			e.Author = ""
+			e.CommentsURL = ""
+			e.Starred = false
+		}, url.Values{}, 0, DefaultSettings(), nil)},
+		{"entry_read_next.gmi", entryPage(t, func(*miniflux.Entry) {}, url.Values{"offset": {"3"}}, 0, readNext, nil)},
+		{"entry_read_next_starred.gmi", entryPage(t, func(*miniflux.Entry) {},
+			url.Values{"offset": {"3"}, "starred": {"true"}, "statuses": {"unread", "read"}}, 0, readNext, nil)},
+		{"entry_fr.gmi", entryPage(t, func(*miniflux.Entry) {}, url.Values{"offset": {"2"}}, 0, french, nil)},
+		{"entry_conversion.gmi", entryPage(t, func(e *miniflux.Entry) {
+			e.Content = `<h1>Title</h1><h2>Intro</h2><p>Hello <a href="https://example.com">world</a>.</p>` +
+				`<img src="https://example.com/a.png" alt="A picture">` +
+				`<table><tr><th>Name</th><th>Value</th></tr><tr><td><a href="https://a.example">a</a></td><td>1</td></tr></table>`
+		}, url.Values{}, 0, settingsWith(func(s *Settings) {
+			s.Conversion = ConversionOptions{Links: "plain", LinkFrequency: 1, Images: "none", Tables: "pretty", HeadingOffset: 1}
+		}), nil)},
+		{"entry_pages.gmi", entryPage(t, longContent, url.Values{"offset": {"2"}}, 0, paged, nil)},
+		{"entry_pages_last.gmi", entryPage(t, longContent, url.Values{"offset": {"2"}}, 3, paged, nil)},
+		{"entry_media.gmi", entryPage(t, func(e *miniflux.Entry) {
+			e.Content = ""
+			e.Enclosures = fixtureEnclosures
+		}, url.Values{"feedID": {"10"}}, 0, DefaultSettings(), map[int64]int{1: 3723})},
+
+		{"settings.gmi", settingsPage(DefaultSettings(), "", "")},
+		{"settings_changed.gmi", settingsPage(settingsWith(func(s *Settings) {
+			s.Direction = "asc"
+			s.AutoMarkRead = AutoMarkReadNext
+			s.HideEmptyFeeds = true
+			s.Timezone = "Europe/Paris"
+			s.Language = "de"
+			s.DateFormat = "Monday 2 January 2006 15:04"
+		}), "America/New_York", "fr_FR")},
+		{"settings_profile.gmi", settingsPage(DefaultSettings(), "Europe/Paris", "fr_FR")},
+
+		{"conversion.gmi", NewConversionPage(DefaultConversion, nil, nil, DefaultSettings())},
+		{"conversion_feed.gmi", NewConversionPage(
+			ConversionOptions{Links: "none", LinkFrequency: 3, Images: "links", Tables: "pretty", HeadingOffset: 2, WebLinks: "reader"},
+			url.Values{"links": {"none"}, "heading_offset": {"2"}}, fixtureFeed, DefaultSettings())},
+
+		{"media.gmi", mediaPage(fixtureFeed, DefaultSettings(), 2)},
+		{"media_fr.gmi", mediaPage(nil, french, 1)},
+		{"media_empty.gmi", mediaPage(fixtureFeed, DefaultSettings(), 0)},
+
+		{"reader.gmi", readerPage(t, DefaultSettings())},
+		{"reader_links.gmi", readerPage(t, settingsWith(func(s *Settings) { s.Conversion.WebLinks = WebLinksReader }))},
+
+		{"subscribe.gmi", NewSubscribePage("https://example.com", miniflux.Subscriptions{
+			{Title: "Blog", URL: "https://example.com/feed.xml", Type: "atom"},
+			{URL: "https://example.com/comments.xml", Type: "rss"},
+		}, miniflux.Categories{fixtureTech, fixtureMisc}, DefaultSettings())},
+		{"subscribe_empty.gmi", NewSubscribePage("https://example.com", nil, miniflux.Categories{fixtureTech, fixtureMisc}, DefaultSettings())},
+
+		{"feed.gmi", feedPage(nil, false, DefaultSettings(), 2, 0)},
+		{"feed_paris.gmi", feedPage(fixtureFeed, false, settingsWith(func(s *Settings) { s.Timezone = "Europe/Paris" }), 1, 0)},
+		{"feed_fr.gmi", feedPage(nil, true, french, 1, 0)},
+		{"feed_empty.gmi", feedPage(fixtureFeed, false, DefaultSettings(), 0, 0)},
+		{"feed_scan_cut.gmi", feedPage(nil, false, DefaultSettings(), 1, 1000)},
+
+		{"views.gmi", NewViewsPage(views, DefaultSettings())},
+		{"views_fr.gmi", NewViewsPage(views[:1], french)},
+		{"views_empty.gmi", NewViewsPage(nil, DefaultSettings())},
+
+		{"tags.gmi", NewTagsPage(tagged, DefaultSettings())},
+		{"tags_fr.gmi", NewTagsPage(tagged[:1], french)},
+		{"tags_empty.gmi", NewTagsPage(miniflux.Entries{fixtureEntry()}, DefaultSettings())},
+
+		{"history.gmi", historyPage(DefaultSettings(), 2, 30, 0)},
+		{"history_last.gmi", historyPage(DefaultSettings(), 2, 42, 40)},
+		{"history_fr.gmi", historyPage(french, 1, 1, 0)},
+		{"history_empty.gmi", historyPage(DefaultSettings(), 0, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.page.Render(&buf); err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			validateGemtext(t, buf.String())
+			checkGolden(t, tt.name, buf.Bytes())
+		})
+	}
+}
+
+func TestEntryFeedAtomGolden(t *testing.T) {
+	second := fixtureEntry()
+	second.ID, second.Title, second.Author, second.URL = 101, "Second <post>", "", ""
+	second.Date = fixtureDate.Add(-time.Hour)
+	entries := miniflux.Entries{fixtureEntry(), second}
+
+	base := &url.URL{Scheme: "gemini", Host: "example.com", Path: "/feed.atom", RawQuery: "feedID=10"}
+	page := NewEntryFeed(entries, fixtureFeed, nil, false, base, DefaultSettings())
+	var buf bytes.Buffer
+	if err := page.RenderAtom(&buf); err != nil {
+		t.Fatalf("RenderAtom: %v", err)
+	}
+	checkGolden(t, "feed.atom", buf.Bytes())
+}
+
+func TestMalformedLines(t *testing.T) {
+	for _, line := range []string{
+		"=>",
+		"=>   ",
+		"=> %zz label",
+		"=> /entry?search=été Search",
+		"=> /entry?search=a\u00a0b Search",
+		"=> /entry?search=a\"b Search",
+		"=> /entry?tag=%zz Tag",
+		"=> /entry?search=a;b Search",
+	} {
+		if len(malformedLines(line)) == 0 {
+			t.Errorf("%q wasn’t reported as malformed", line)
+		}
+	}
+	if malformed := malformedLines("```\n=>\n```\n=> /entry Entry\n=>/entry?search=%C3%A9t%C3%A9&tag=Go\tSearch"); len(malformed) != 0 {
+		t.Errorf("valid gemtext reported as malformed: %v", malformed)
+	}
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+var (
+	//go:embed templates/history.gmi
+	historyTxt string
+)
+
+// HistoryPage lists read entries, the ones read last first, a page at a time
+type HistoryPage struct {
+	Entries miniflux.Entries
+	// Of read entries, to tell whether there are older ones
+	Total int
+	// Of the first entry of the page in the history
+	Offset   int
+	now      time.Time
+	settings Settings
+}
+
+func NewHistoryPage(entries miniflux.Entries, total, offset int, settings Settings) *HistoryPage {
+	return &HistoryPage{
+		Entries:  entries,
+		Total:    total,
+		Offset:   offset,
+		now:      time.Now(),
+		settings: settings,
+	}
+}
+
+// ReadAgo tells how long ago the entry was read, as far as Miniflux knows:
+// its status is the last thing that changed for read entries
+func (page *HistoryPage) ReadAgo(entry *miniflux.Entry) string {
+	return page.settings.Ago(entry.ChangedAt, page.now)
+}
+
+// MarkUnread returns the params marking the entry as unread, coming back to
+// this page
+func (page *HistoryPage) MarkUnread(entry *miniflux.Entry) string {
+	return fmt.Sprintf("_id=%d&_status=%s&_from=history&offset=%d", entry.ID, miniflux.EntryStatusUnread, page.Offset)
+}
+
+// Newer returns the params of the previous page, empty on the first one
+func (page *HistoryPage) Newer() string {
+	if page.Offset == 0 {
+		return ""
+	}
+	return fmt.Sprintf("offset=%d", max(page.Offset-page.settings.PageSize, 0))
+}
+
+// Older returns the params of the next page, empty on the last one
+func (page *HistoryPage) Older() string {
+	next := page.Offset + len(page.Entries)
+	if len(page.Entries) == 0 || next >= page.Total {
+		return ""
+	}
+	return fmt.Sprintf("offset=%d", next)
+}
+
+func (page *HistoryPage) Render(w io.Writer) error {
+	return render(historyTemplate, w, page.settings.Lang(), page)
+}
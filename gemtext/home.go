@@ -28,13 +28,15 @@ import (
 
 var (
 	//go:embed templates/home.gmi
-	homeTxt  string
-	homeTmpl = geminiTemplate("home", homeTxt)
+	homeTxt string
 )
 
 type Home struct {
 	Categories []*RichCategory
-	query      *url.Values
+	// Saved by the user, with their unread counts
+	Views    []*SavedView
+	query    *url.Values
+	settings Settings
 }
 
 // Categories enriched with their Feeds
@@ -43,7 +45,7 @@ type RichCategory struct {
 	Feeds []*miniflux.Feed
 }
 
-func NewHome(categories *miniflux.Categories, feeds *miniflux.Feeds, query *url.Values) (*Home, error) {
+func NewHome(categories *miniflux.Categories, feeds *miniflux.Feeds, query *url.Values, settings Settings) (*Home, error) {
 	if categories == nil || query == nil {
 		return nil, fmt.Errorf("error trying to render with nil arguments")
 	}
@@ -62,17 +64,14 @@ func NewHome(categories *miniflux.Categories, feeds *miniflux.Feeds, query *url.
 	return &Home{
 		Categories: richCategories,
 		query:      query,
+		settings:   settings,
 	}, nil
 }
 
 func feedsByCategoryID(feeds *miniflux.Feeds, categoryHint int) map[int64][]*miniflux.Feed {
 	feedsByCategory := make(map[int64][]*miniflux.Feed, categoryHint)
 	for _, feed := range *feeds {
-		if feeds, ok := feedsByCategory[feed.Category.ID]; ok {
-			feedsByCategory[feed.Category.ID] = append(feeds, feed)
-		} else {
-			feedsByCategory[feed.Category.ID] = make([]*miniflux.Feed, 0)
-		}
+		feedsByCategory[feed.Category.ID] = append(feedsByCategory[feed.Category.ID], feed)
 	}
 
 	return feedsByCategory
@@ -82,7 +81,12 @@ func (home *Home) Params(key_values ...string) (string, error) {
 	return params(home.query, key_values...)
 }
 
+// NewView returns the path saving the current filter as a view
+func (home *Home) NewView() string {
+	return NewViewPath(*home.query)
+}
+
 func (home *Home) Render(w io.Writer) error {
-	return homeTmpl.Execute(w, home)
+	return render(homeTemplate, w, home.settings.Lang(), home)
 }
 
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"fmt"
+	"io"
+	"text/template"
+)
+
+// Languages of the interface and dates
+var Languages = []string{"en", "fr", "de", "es"}
+
+// Names of Languages, in themselves
+var languageNames = map[string]string{
+	"en": "English",
+	"fr": "Français",
+	"de": "Deutsch",
+	"es": "Español",
+}
+
+// DefaultLanguage is used when neither the user nor their Miniflux profile
+// chose a supported language
+var DefaultLanguage = "en"
+
+// A catalog maps messages, identified by their English text, to their
+// translation. Messages may be fmt formats, translations take the same
+// arguments.
+type catalog map[string]string
+
+// Catalogs of the interface, by language. Missing messages, like all of
+// them for languages that only have dates translated, stay in English.
+var catalogs = map[string]catalog{
+	"fr": frenchCatalog,
+}
+
+// Translate returns msg in lang, formatted with args if there are some
+func Translate(lang, msg string, args ...any) string {
+	if translated, ok := catalogs[lang][msg]; ok {
+		msg = translated
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// InvalidValueError tells why a value entered by the user is refused, with a
+// message that can be translated
+type InvalidValueError struct {
+	Msg  string
+	Args []any
+}
+
+func invalidValue(msg string, args ...any) error {
+	return &InvalidValueError{Msg: msg, Args: args}
+}
+
+func (e *InvalidValueError) Error() string {
+	return Translate("en", e.Msg, e.Args...)
+}
+
+// Translate returns the message in lang
+func (e *InvalidValueError) Translate(lang string) string {
+	return Translate(lang, e.Msg, e.Args...)
+}
+
+// translator backs the t template function
+func translator(lang string) func(string, ...any) string {
+	return func(msg string, args ...any) string {
+		return Translate(lang, msg, args...)
+	}
+}
+
+// execute renders tmpl with the t template function translating to lang
+func execute(tmpl *template.Template, w io.Writer, lang string, data any) error {
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	return tmpl.Funcs(template.FuncMap{"t": translator(lang)}).Execute(w, data)
+}
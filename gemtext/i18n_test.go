@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var (
+	verbs        = regexp.MustCompile(`%[a-z]`)
+	templateMsgs = regexp.MustCompile(`{{ t "([^"]*)"`)
+)
+
+func TestCatalogs(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for msg, translated := range catalog {
+			if !slices.Equal(verbs.FindAllString(msg, -1), verbs.FindAllString(translated, -1)) {
+				t.Errorf("%s: %q doesn’t take the arguments of %q", lang, translated, msg)
+			}
+		}
+	}
+}
+
+func TestTemplatesTranslated(t *testing.T) {
+	for _, text := range defaultTemplates {
+		for _, match := range templateMsgs.FindAllStringSubmatch(text, -1) {
+			for lang, catalog := range catalogs {
+				if _, ok := catalog[match[1]]; !ok {
+					t.Errorf("%s: no translation for %q", lang, match[1])
+				}
+			}
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		lang, msg string
+		args      []any
+		want      string
+	}{
+		{"en", "Mark read", nil, "Mark read"},
+		{"fr", "Mark read", nil, "Marquer comme lu"},
+		{"de", "Mark read", nil, "Mark read"},
+		{"fr", "%d entries per page", []any{20}, "20 articles par page"},
+		{"fr", "Not in any catalog: 100%", nil, "Not in any catalog: 100%"},
+	}
+
+	for _, tt := range tests {
+		if got := Translate(tt.lang, tt.msg, tt.args...); got != tt.want {
+			t.Errorf("Translate(%q, %q) = %q, want %q", tt.lang, tt.msg, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+var (
+	//go:embed templates/media.gmi
+	mediaTxt string
+)
+
+// ProxyMedia returns the link to get a media file through the server. Images
+// and enclosures of entries are rewritten with it, when it is set
+var ProxyMedia func(url string) string
+
+// proxyMedia rewrites http(s) URLs with ProxyMedia, if it is set
+func proxyMedia(target string) string {
+	if ProxyMedia == nil {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return target
+	}
+	return ProxyMedia(target)
+}
+
+// Enclosure is a file attached to an entry, like a podcast episode
+type Enclosure struct {
+	*miniflux.Enclosure
+	// Position reached in the audio or video, in seconds, 0 if unknown
+	MediaProgression int
+	lang             string
+}
+
+// enclosures wraps the enclosures of an entry, with the position reached in
+// each by enclosure ID, which can be nil
+func enclosures(list miniflux.Enclosures, progressions map[int64]int, lang string) []*Enclosure {
+	wrapped := make([]*Enclosure, 0, len(list))
+	for _, enclosure := range list {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		wrapped = append(wrapped, &Enclosure{
+			Enclosure:        enclosure,
+			MediaProgression: progressions[enclosure.ID],
+			lang:             lang,
+		})
+	}
+	return wrapped
+}
+
+// Kind returns audio, video, image, or "" for other files
+func (e *Enclosure) Kind() string {
+	kind, _, _ := strings.Cut(e.MimeType, "/")
+	switch kind {
+	case "audio", "video", "image":
+		return kind
+	default:
+		return ""
+	}
+}
+
+// Icon shows the kind of the file
+func (e *Enclosure) Icon() string {
+	switch e.Kind() {
+	case "audio":
+		return "🎧"
+	case "video":
+		return "🎬"
+	case "image":
+		return "🖼"
+	default:
+		return "📎"
+	}
+}
+
+// Name returns the file name of the enclosure, or its URL if it has none
+func (e *Enclosure) Name() string {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return e.URL
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return e.URL
+	}
+	return name
+}
+
+// HumanSize returns the size of the file, like 12.3 MB, or "" if unknown
+func (e *Enclosure) HumanSize() string {
+	if e.Size <= 0 {
+		return ""
+	}
+	return formatSize(e.Size, e.lang)
+}
+
+// Details returns the MIME type and the size of the file, when known
+func (e *Enclosure) Details() string {
+	var details []string
+	if e.MimeType != "" {
+		details = append(details, lineBreaks.Replace(e.MimeType))
+	}
+	if size := e.HumanSize(); size != "" {
+		details = append(details, size)
+	}
+	return strings.Join(details, ", ")
+}
+
+// Progress returns the position reached in the audio or video, like 1:02:03,
+// or "" if it wasn’t started
+func (e *Enclosure) Progress() string {
+	if e.MediaProgression <= 0 {
+		return ""
+	}
+	hours, minutes, seconds := e.MediaProgression/3600, e.MediaProgression/60%60, e.MediaProgression%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// Units of file sizes, in powers of 1000
+var sizeUnits = []string{"B", "kB", "MB", "GB", "TB"}
+
+// Languages writing 1,5 instead of 1.5
+var decimalCommas = []string{"fr", "de", "es"}
+
+// formatSize returns size in bytes with a unit that makes it short, in lang
+func formatSize(size int, lang string) string {
+	value, unit := float64(size), 0
+	for value >= 1000 && unit < len(sizeUnits)-1 {
+		value /= 1000
+		unit++
+	}
+
+	number := fmt.Sprintf("%.1f", value)
+	if unit == 0 || value >= 100 {
+		number = fmt.Sprintf("%.0f", value)
+	}
+	number = strings.TrimSuffix(number, ".0")
+	if slices.Contains(decimalCommas, lang) {
+		number = strings.Replace(number, ".", ",", 1)
+	}
+	return number + " " + Translate(lang, sizeUnits[unit])
+}
+
+// MediaEntry is an entry listed in the media view, with its enclosures
+type MediaEntry struct {
+	*miniflux.Entry
+	Attachments []*Enclosure
+}
+
+// MediaPage lists recent entries with enclosures, like podcast episodes
+type MediaPage struct {
+	// Nil for entries of all feeds
+	Feed     *miniflux.Feed
+	Entries  []*MediaEntry
+	now      time.Time
+	settings Settings
+}
+
+// NewMediaPage keeps the entries with enclosures, up to the page size of the
+// user
+func NewMediaPage(entries miniflux.Entries, feed *miniflux.Feed, settings Settings) *MediaPage {
+	page := &MediaPage{Feed: feed, now: time.Now(), settings: settings}
+	for _, entry := range entries {
+		attachments := enclosures(entry.Enclosures, nil, settings.Lang())
+		if len(attachments) == 0 {
+			continue
+		}
+		page.Entries = append(page.Entries, &MediaEntry{Entry: entry, Attachments: attachments})
+		if len(page.Entries) == settings.PageSize {
+			break
+		}
+	}
+	return page
+}
+
+// FormatDate formats t as the user prefers
+func (page *MediaPage) FormatDate(t time.Time) string {
+	return page.settings.FormatDate(t)
+}
+
+// Ago tells how long before now t is, like “3 hours ago”
+func (page *MediaPage) Ago(t time.Time) string {
+	return page.settings.Ago(t, page.now)
+}
+
+func (page *MediaPage) Render(w io.Writer) error {
+	return render(mediaTemplate, w, page.settings.Lang(), page)
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int
+		lang string
+		want string
+	}{
+		{812, "en", "812 B"},
+		{1000, "en", "1 kB"},
+		{48_300_000, "en", "48.3 MB"},
+		{48_300_000, "fr", "48,3 Mo"},
+		{123_456_789, "de", "123 MB"},
+	}
+	for _, tt := range tests {
+		if got := formatSize(tt.size, tt.lang); got != tt.want {
+			t.Errorf("formatSize(%d, %q) = %q, want %q", tt.size, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestProxyMedia(t *testing.T) {
+	ProxyMedia = func(target string) string { return "/proxy?" + url.QueryEscape(target) }
+	t.Cleanup(func() { ProxyMedia = nil })
+
+	gemini, err := htmlToGemini(`<p>Text</p><img src="https://example.com/a.png" alt="A picture"><img src="data:image/png;base64,AA" alt="Inline">`, DefaultConversion)
+	if err != nil {
+		t.Fatalf("htmlToGemini: %v", err)
+	}
+	if !strings.Contains(gemini, "=> /proxy?https%3A%2F%2Fexample.com%2Fa.png") {
+		t.Errorf("image isn’t linked through the proxy:\n%s", gemini)
+	}
+	if !strings.Contains(gemini, "=> data:image/png") {
+		t.Errorf("inline image was rewritten:\n%s", gemini)
+	}
+
+	entry := fixtureEntry()
+	entry.Enclosures = fixtureEnclosures
+	templatable, err := NewTemplatableEntry(entry, &url.Values{}, 1, DefaultSettings())
+	if err != nil {
+		t.Fatalf("NewTemplatableEntry: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := templatable.Render(&buf); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(buf.String(), "=> /proxy?https%3A%2F%2Fblog.example%2Fcover.jpg 🖼") {
+		t.Errorf("enclosure isn’t linked through the proxy:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"strings"
+)
+
+// Heading of the converted content, listed in the table of contents of
+// entries split in pages
+type Heading struct {
+	Level int
+	Text  string
+	// Page the heading is on, from 1
+	Page int
+}
+
+// splitPages splits gemtext in pages of at most maxLength bytes. Pages start
+// at a heading when that keeps the previous one at least half full, then at a
+// paragraph, then at any line. Preformatted blocks are kept whole, so a page
+// can be longer if one of them is
+func splitPages(content string, maxLength int) []string {
+	if maxLength <= 0 || len(content) <= maxLength {
+		return []string{content}
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		// After the last line break, it would be a page of its own
+		lines = lines[:len(lines)-1]
+	}
+	// Where each line starts in content, and where it ends
+	offsets := make([]int, len(lines)+1)
+	for i, line := range lines {
+		offsets[i+1] = offsets[i] + len(line)
+	}
+
+	var pages []string
+	start := 0
+	// Latest lines that could start the next page, by preference, -1 if none
+	heading, paragraph, line := -1, -1, -1
+	preformatted := false
+	for i, l := range lines {
+		if i > start && !preformatted {
+			if isHeading(l) {
+				heading = i
+			} else if strings.TrimSpace(lines[i-1]) == "" {
+				paragraph = i
+			}
+			line = i
+		}
+		if strings.HasPrefix(l, "```") {
+			preformatted = !preformatted
+		}
+		// Cutting at a heading or a paragraph can leave more than a page
+		for offsets[i+1]-offsets[start] > maxLength {
+			cut := line
+			for _, candidate := range []int{heading, paragraph} {
+				if candidate > start && offsets[candidate]-offsets[start] >= maxLength/2 {
+					cut = candidate
+					break
+				}
+			}
+			if cut <= start {
+				// A line or a preformatted block longer than a page
+				break
+			}
+			// Blank lines between paragraphs aren’t needed at the end of a page
+			pages = append(pages, strings.TrimRight(content[offsets[start]:offsets[cut]], "\n")+"\n")
+			start = cut
+			if heading <= cut {
+				heading = -1
+			}
+			if paragraph <= cut {
+				paragraph = -1
+			}
+			if line <= cut {
+				line = -1
+			}
+		}
+	}
+	return append(pages, content[offsets[start]:])
+}
+
+// pageHeadings returns the headings of the pages, outside preformatted blocks
+func pageHeadings(pages []string) []Heading {
+	var headings []Heading
+	for i, page := range pages {
+		preformatted := false
+		for _, line := range strings.Split(page, "\n") {
+			if strings.HasPrefix(line, "```") {
+				preformatted = !preformatted
+			}
+			if preformatted || !isHeading(line) {
+				continue
+			}
+			text := strings.TrimLeft(line, "#")
+			headings = append(headings, Heading{
+				Level: len(line) - len(text),
+				Text:  strings.TrimSpace(text),
+				Page:  i + 1,
+			})
+		}
+	}
+	return headings
+}
+
+func isHeading(line string) bool {
+	return strings.HasPrefix(line, "#")
+}
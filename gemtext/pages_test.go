@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		maxLength int
+		want      []string
+	}{
+		{
+			name:      "short",
+			content:   "# One\ntext\n",
+			maxLength: 100,
+			want:      []string{"# One\ntext\n"},
+		},
+		{
+			name:      "disabled",
+			content:   "# One\ntext\n",
+			maxLength: 0,
+			want:      []string{"# One\ntext\n"},
+		},
+		{
+			name:      "at heading",
+			content:   "# One\naaaa\n\n## Two\nbbbb\n",
+			maxLength: 20,
+			want:      []string{"# One\naaaa\n", "## Two\nbbbb\n"},
+		},
+		{
+			name:      "at paragraph rather than early heading",
+			content:   "# One\naaaaaaaaaa\n\nbbbbbbbbbb\n",
+			maxLength: 20,
+			want:      []string{"# One\naaaaaaaaaa\n", "bbbbbbbbbb\n"},
+		},
+		{
+			name:      "at line",
+			content:   "aaaaaaaaaa\nbbbbbbbbbb\ncccccccccc\n",
+			maxLength: 25,
+			want:      []string{"aaaaaaaaaa\nbbbbbbbbbb\n", "cccccccccc\n"},
+		},
+		{
+			name:      "preformatted kept whole",
+			content:   "text\n```\n# not a heading\nline\n```\nend\n",
+			maxLength: 10,
+			want:      []string{"text\n", "```\n# not a heading\nline\n```\n", "end\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitPages(tt.content, tt.maxLength); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitPages = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageHeadings(t *testing.T) {
+	pages := []string{"# One\ntext\n```\n# not a heading\n```\n", "## Two\n### Three  \n"}
+	want := []Heading{{1, "One", 1}, {2, "Two", 2}, {3, "Three", 2}}
+	if got := pageHeadings(pages); !reflect.DeepEqual(got, want) {
+		t.Errorf("pageHeadings = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	"git.sr.ht/~adnano/go-gemini"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	miniflux "miniflux.app/client"
+)
+
+var (
+	//go:embed templates/reader.gmi
+	readerTxt string
+	//go:embed templates/subscribe.gmi
+	subscribeTxt string
+)
+
+// Values of the web_links conversion option
+const (
+	WebLinksDirect = "direct"
+	// Links to web pages go through the reader
+	WebLinksReader = "reader"
+)
+
+// ReaderLink returns the link to read the web page at target as gemtext
+func ReaderLink(target string) string {
+	return "/read?" + gemini.QueryEscape(target)
+}
+
+// Elements that are never part of the readable content of a web page
+var unreadable = []atom.Atom{
+	atom.Script, atom.Style, atom.Noscript, atom.Template, atom.Iframe,
+	atom.Object, atom.Embed, atom.Svg, atom.Canvas, atom.Form,
+	atom.Button, atom.Dialog, atom.Nav, atom.Header, atom.Footer,
+	atom.Aside,
+}
+
+// readable extracts the title and the main content of a web page: its only
+// article, its main element, or else its body, without navigation, scripts
+// and the like. Links are made absolute with base.
+func readable(page string, base *url.URL) (title, content string, err error) {
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		return "", "", err
+	}
+
+	var articles []*html.Node
+	var mainElement, body, baseElement *html.Node
+	walk(doc, func(n *html.Node) {
+		switch {
+		case n.DataAtom == atom.Title && title == "":
+			title = strings.Join(strings.Fields(textContent(n)), " ")
+		case n.DataAtom == atom.Base && baseElement == nil:
+			baseElement = n
+		case n.DataAtom == atom.Article:
+			articles = append(articles, n)
+		case n.DataAtom == atom.Main || attr(n, "role") == "main":
+			if mainElement == nil {
+				mainElement = n
+			}
+		case n.DataAtom == atom.Body:
+			body = n
+		}
+	})
+	if baseElement != nil {
+		if href, err := base.Parse(attr(baseElement, "href")); err == nil {
+			base = href
+		}
+	}
+
+	root := body
+	switch {
+	case len(articles) == 1:
+		root = articles[0]
+	case mainElement != nil:
+		root = mainElement
+	}
+	if root == nil {
+		return title, "", nil
+	}
+
+	removeUnreadable(root)
+	walk(root, func(n *html.Node) {
+		for i, a := range n.Attr {
+			if a.Key != "href" && a.Key != "src" {
+				continue
+			}
+			if u, err := base.Parse(strings.TrimSpace(a.Val)); err == nil {
+				n.Attr[i].Val = u.String()
+			}
+		}
+	})
+
+	var rendered strings.Builder
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&rendered, c); err != nil {
+			return "", "", err
+		}
+	}
+	return title, rendered.String(), nil
+}
+
+// walk calls f on the elements under n, in document order
+func walk(n *html.Node, f func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		f(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, f)
+	}
+}
+
+func removeUnreadable(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode,
+			c.Type == html.ElementNode && (slices.Contains(unreadable, c.DataAtom) || hidden(c)):
+			n.RemoveChild(c)
+		default:
+			removeUnreadable(c)
+		}
+		c = next
+	}
+}
+
+func hidden(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Key == "hidden" || a.Key == "aria-hidden" && a.Val == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	var text strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	return text.String()
+}
+
+// ReaderPage is a web page converted to gemtext, for links of entries that
+// lead out of Gemini
+type ReaderPage struct {
+	URL           string
+	Title         string
+	GeminiContent string
+	settings      Settings
+}
+
+// NewReaderPage extracts the readable content of the HTML page found at
+// pageURL and converts it like entries
+func NewReaderPage(pageURL, page string, settings Settings) (*ReaderPage, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("NewReaderPage: %w", err)
+	}
+	title, content, err := readable(page, base)
+	if err != nil {
+		return nil, fmt.Errorf("NewReaderPage: %w", err)
+	}
+	if title == "" {
+		title = base.Host
+	}
+	geminiContent, err := convert(content, settings.Conversion)
+	if err != nil {
+		return nil, fmt.Errorf("NewReaderPage: %w", err)
+	}
+	return &ReaderPage{
+		URL:           pageURL,
+		Title:         title,
+		GeminiContent: geminiContent,
+		settings:      settings,
+	}, nil
+}
+
+// Subscribe returns the link to subscribe to the feeds of the site
+func (page *ReaderPage) Subscribe() string {
+	return "/subscribe?" + gemini.QueryEscape(page.URL)
+}
+
+func (page *ReaderPage) Render(w io.Writer) error {
+	return render(readerTemplate, w, page.settings.Lang(), page)
+}
+
+// SubscribePage lists the feeds Miniflux found on a web page, with a link to
+// subscribe to each in each category
+type SubscribePage struct {
+	URL           string
+	Subscriptions miniflux.Subscriptions
+	Categories    miniflux.Categories
+	settings      Settings
+}
+
+func NewSubscribePage(pageURL string, subscriptions miniflux.Subscriptions, categories miniflux.Categories, settings Settings) *SubscribePage {
+	return &SubscribePage{
+		URL:           pageURL,
+		Subscriptions: subscriptions,
+		Categories:    categories,
+		settings:      settings,
+	}
+}
+
+// Link returns the link to subscribe to the feed in the category
+func (page *SubscribePage) Link(feedURL string, categoryID int64) string {
+	return fmt.Sprintf("/subscribe/%d?%s", categoryID, gemini.QueryEscape(feedURL))
+}
+
+func (page *SubscribePage) Render(w io.Writer) error {
+	return render(subscribeTemplate, w, page.settings.Lang(), page)
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestReadable(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post.html")
+	tests := []struct {
+		name      string
+		page      string
+		wantTitle string
+		want      []string
+		dropped   []string
+	}{
+		{
+			name:      "article",
+			page:      `<title> The  post </title><nav>Menu</nav><article><p>Text</p></article><aside>Related</aside>`,
+			wantTitle: "The post",
+			want:      []string{"<p>Text</p>"},
+			dropped:   []string{"Menu", "Related"},
+		},
+		{
+			name:    "several articles",
+			page:    `<nav>Menu</nav><main><article>One</article><article>Two</article></main><footer>Footer</footer>`,
+			want:    []string{"One", "Two"},
+			dropped: []string{"Menu", "Footer"},
+		},
+		{
+			name:    "role main",
+			page:    `<div>Banner</div><div role="main"><p>Text</p></div>`,
+			want:    []string{"<p>Text</p>"},
+			dropped: []string{"Banner"},
+		},
+		{
+			name:    "body",
+			page:    `<p>Text</p><script>alert(1)</script><div hidden>Popup</div><!-- comment -->`,
+			want:    []string{"<p>Text</p>"},
+			dropped: []string{"alert", "Popup", "comment"},
+		},
+		{
+			name: "relative links",
+			page: `<a href="other.html">Other</a><a href="/">Home</a><img src="//cdn.example/a.png"><a href="mailto:a@example.com">Mail</a>`,
+			want: []string{
+				`href="https://example.com/blog/other.html"`,
+				`href="https://example.com/"`,
+				`src="https://cdn.example/a.png"`,
+				`href="mailto:a@example.com"`,
+			},
+		},
+		{
+			name: "base element",
+			page: `<head><base href="https://static.example/"></head><a href="page.html">Page</a>`,
+			want: []string{`href="https://static.example/page.html"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, content, err := readable(tt.page, base)
+			if err != nil {
+				t.Fatalf("readable: %v", err)
+			}
+			if title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", title, tt.wantTitle)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("content doesn’t contain %q:\n%s", want, content)
+				}
+			}
+			for _, dropped := range tt.dropped {
+				if strings.Contains(content, dropped) {
+					t.Errorf("content contains %q:\n%s", dropped, content)
+				}
+			}
+		})
+	}
+}
+
+func TestReadWebLinks(t *testing.T) {
+	options := DefaultConversion
+	options.WebLinks = WebLinksReader
+
+	gemini, err := htmlToGemini(`<p><a href="https://example.com/a b">Web</a></p><p><a href="mailto:a@example.com">Mail</a></p><p><a href="gemini://example.com">Gemini</a></p>`, options)
+	if err != nil {
+		t.Fatalf("htmlToGemini: %v", err)
+	}
+	for _, want := range []string{"=> /read?https:%2F%2Fexample.com%2Fa%2520b", "=> a@example.com", "=> gemini://example.com"} {
+		if !strings.Contains(gemini, want) {
+			t.Errorf("converted content doesn’t contain %q:\n%s", want, gemini)
+		}
+	}
+}
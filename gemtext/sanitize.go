@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// Line breaks are just spaces in HTML, but html2gemini copies some of
+	// them as is, starting new gemtext lines
+	lineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+	// Browsers drop these from URLs
+	urlBreaks = strings.NewReplacer("\r", "", "\n", "", "\t", "")
+	// Would end the preformatted block html2gemini puts <pre> in
+	preformattedToggle = regexp.MustCompile("(?m)^```")
+)
+
+// Headings html2gemini converts, by level
+var headings = []atom.Atom{atom.H1, atom.H2, atom.H3}
+
+// sanitizeHTML rewrites the parts of feed HTML that would otherwise let its
+// author inject arbitrary gemtext lines, like links. It also applies the
+// options html2gemini doesn’t have: headings are moved down, without going
+// below the last gemtext level, and tables are drawn.
+func sanitizeHTML(content string, options ConversionOptions) (string, error) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	if options.Tables == "pretty" {
+		drawTables(doc)
+	}
+	if options.Images == "none" {
+		removeImages(doc)
+	}
+	sanitizeNode(doc, false, options.HeadingOffset)
+	if options.WebLinks == WebLinksReader {
+		readWebLinks(doc)
+	}
+
+	var sanitized strings.Builder
+	if err := html.Render(&sanitized, doc); err != nil {
+		return "", err
+	}
+	return sanitized.String(), nil
+}
+
+func sanitizeNode(n *html.Node, preformatted bool, headingOffset int) {
+	switch n.Type {
+	case html.TextNode:
+		if preformatted {
+			n.Data = preformattedToggle.ReplaceAllString(n.Data, " ```")
+		} else {
+			n.Data = lineBreaks.Replace(n.Data)
+		}
+	case html.ElementNode:
+		preformatted = preformatted || n.DataAtom == atom.Pre
+		if level := slices.Index(headings, n.DataAtom); level >= 0 && headingOffset > 0 {
+			level = min(level+headingOffset, len(headings)-1)
+			n.DataAtom, n.Data = headings[level], headings[level].String()
+		}
+		for i, attr := range n.Attr {
+			switch attr.Key {
+			case "href", "src":
+				n.Attr[i].Val = urlBreaks.Replace(attr.Val)
+				if n.DataAtom == atom.Img && attr.Key == "src" {
+					n.Attr[i].Val = proxyMedia(n.Attr[i].Val)
+				}
+			default:
+				n.Attr[i].Val = lineBreaks.Replace(attr.Val)
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sanitizeNode(c, preformatted, headingOffset)
+	}
+}
+
+// readWebLinks rewrites links to web pages so that they are read through the
+// reader, other links like mailto: are kept
+func readWebLinks(n *html.Node) {
+	if n.Type == html.ElementNode && n.DataAtom == atom.A {
+		for i, attr := range n.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			if u, err := url.Parse(strings.TrimSpace(attr.Val)); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+				n.Attr[i].Val = ReaderLink(u.String())
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		readWebLinks(c)
+	}
+}
+
+// removeImages removes images, which html2gemini would show as their
+// alternative text otherwise
+func removeImages(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.DataAtom == atom.Img {
+			n.RemoveChild(c)
+		} else {
+			removeImages(c)
+		}
+		c = next
+	}
+}
@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	_ "embed"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	//go:embed templates/settings.gmi
+	settingsTxt string
+)
+
+// Settings are the reading preferences of a user
+type Settings struct {
+	Order        string
+	Direction    string
+	PageSize     int
+	AutoMarkRead string
+	DateFormat   string
+	// IANA timezone, empty to use the one of the Miniflux profile
+	Timezone string
+	// Language of the interface, empty to use the one of the Miniflux profile
+	Language       string
+	HideEmptyFeeds bool
+	// Length of the pages long entries are split in, in kB, 0 to never split
+	// them
+	PageLength int
+	// How content is converted, with the overrides of the user for all
+	// feeds. They are stored apart from the other settings.
+	Conversion ConversionOptions
+}
+
+// When entries are marked as read without using the Mark read link
+const (
+	AutoMarkReadNever = "never"
+	// As soon as the entry is displayed
+	AutoMarkReadOpen = "open"
+	// When following the Next link of the entry
+	AutoMarkReadNext = "next"
+)
+
+// Orders accepted by the Miniflux API that make sense to read entries in
+var entryOrders = []string{"published_at", "changed_at", "created_at", "title", "category_title"}
+
+const maxPageSize = 100
+
+// In kB, pages shorter than that would mostly be navigation links
+const (
+	minPageLength = 2
+	maxPageLength = 1000
+)
+
+func DefaultSettings() Settings {
+	return Settings{
+		Order:          "published_at",
+		Direction:      "desc",
+		PageSize:       20,
+		AutoMarkRead:   AutoMarkReadNever,
+		DateFormat:     "Jan. 02 2006",
+		Timezone:       "",
+		Language:       "",
+		HideEmptyFeeds: false,
+		PageLength:     0,
+		Conversion:     DefaultConversion,
+	}
+}
+
+// Value of the timezone and language settings to follow the Miniflux profile
+const fromMiniflux = "miniflux"
+
+// WithProfile returns the settings with the timezone and language of the
+// Miniflux profile, unless the user chose others here
+func (s Settings) WithProfile(timezone, language string) Settings {
+	if s.Timezone == "" {
+		s.Timezone = timezone
+	}
+	if s.Language == "" {
+		s.Language = ProfileLanguage(language)
+	}
+	return s
+}
+
+// ProfileLanguage turns a Miniflux language like fr_FR into a supported
+// language, empty if there is none
+func ProfileLanguage(language string) string {
+	language, _, _ = strings.Cut(language, "_")
+	language = strings.ToLower(language)
+	if !slices.Contains(Languages, language) {
+		return ""
+	}
+	return language
+}
+
+// Location returns the timezone of the user, UTC if it is invalid
+func (s *Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Lang returns the language of the interface for the user
+func (s *Settings) Lang() string {
+	if s.Language == "" {
+		return DefaultLanguage
+	}
+	return s.Language
+}
+
+// FormatDate formats t as the user prefers
+func (s *Settings) FormatDate(t time.Time) string {
+	return formatDate(t.In(s.Location()), s.DateFormat, s.Lang())
+}
+
+// Ago tells how long before now t is, like “3 hours ago”, for list views
+func (s *Settings) Ago(t, now time.Time) string {
+	return ago(t, now, s.Lang())
+}
+
+// SettingPrompt returns the question asked to the user to get the value of
+// the setting, in lang, and false if there is no such setting
+func SettingPrompt(key, lang string) (string, bool) {
+	switch key {
+	case "order":
+		return Translate(lang, "Order entries by (%s)", strings.Join(entryOrders, ", ")), true
+	case "direction":
+		return Translate(lang, "Direction (asc or desc)"), true
+	case "page_size":
+		return Translate(lang, "Entries per page (1 to %d)", maxPageSize), true
+	case "auto_mark_read":
+		return Translate(lang, "Mark entries as read automatically (never, open or next)"), true
+	case "hide_empty_feeds":
+		return Translate(lang, "true or false"), true
+	case "page_length":
+		return Translate(lang, "Split long entries in pages of about this many kB (%d to %d), 0 to never split them", minPageLength, maxPageLength), true
+	case "date_format":
+		return Translate(lang, "Date format, as a Go time layout like Jan. 02 2006"), true
+	case "timezone":
+		return Translate(lang, "Timezone, like Europe/Paris, or miniflux to use the one of your Miniflux profile"), true
+	case "language":
+		return Translate(lang, "Language (%s), or miniflux to use the one of your Miniflux profile", strings.Join(Languages, ", ")), true
+	default:
+		return "", false
+	}
+}
+
+// Set parses and validates value, before assigning it to the setting
+// designated by key
+func (s *Settings) Set(key, value string) error {
+	value = strings.TrimSpace(value)
+
+	switch key {
+	case "order":
+		if !slices.Contains(entryOrders, value) {
+			return invalidValue("unknown order %q", value)
+		}
+		s.Order = value
+	case "direction":
+		if value != "asc" && value != "desc" {
+			return invalidValue("unknown direction %q", value)
+		}
+		s.Direction = value
+	case "page_size":
+		pageSize, err := strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return invalidValue("page size must be between 1 and %d", maxPageSize)
+		}
+		s.PageSize = pageSize
+	case "auto_mark_read":
+		switch value {
+		case AutoMarkReadNever, AutoMarkReadOpen, AutoMarkReadNext:
+			s.AutoMarkRead = value
+		default:
+			return invalidValue("expected never, open or next")
+		}
+	case "hide_empty_feeds":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalidValue("expected true or false")
+		}
+		s.HideEmptyFeeds = b
+	case "page_length":
+		length, err := strconv.Atoi(value)
+		if err != nil || length != 0 && (length < minPageLength || length > maxPageLength) {
+			return invalidValue("page length must be 0 or between %d and %d", minPageLength, maxPageLength)
+		}
+		s.PageLength = length
+	case "date_format":
+		if value == "" || strings.ContainsAny(value, "\r\n") {
+			return invalidValue("invalid date format")
+		}
+		s.DateFormat = value
+	case "timezone":
+		if value == fromMiniflux {
+			s.Timezone = ""
+			return nil
+		}
+		// LoadLocation returns UTC for an empty name
+		if _, err := time.LoadLocation(value); err != nil || value == "" {
+			return invalidValue("unknown timezone %q", value)
+		}
+		s.Timezone = value
+	case "language":
+		if value == fromMiniflux {
+			s.Language = ""
+			return nil
+		}
+		if !slices.Contains(Languages, value) {
+			return invalidValue("unknown language %q", value)
+		}
+		s.Language = value
+	default:
+		return invalidValue("unknown setting %q", key)
+	}
+
+	return nil
+}
+
+// SettingsPage shows the settings with links to change them
+type SettingsPage struct {
+	Settings
+	// Settings with the timezone and language of the Miniflux profile, as
+	// used to show dates
+	Effective Settings
+	// Today, to preview the date format
+	Now time.Time
+}
+
+func NewSettingsPage(settings, effective Settings) *SettingsPage {
+	return &SettingsPage{Settings: settings, Effective: effective, Now: time.Now()}
+}
+
+func (page *SettingsPage) Orders() []string {
+	return entryOrders
+}
+
+func (page *SettingsPage) Languages() []string {
+	return Languages
+}
+
+// LanguageName returns the name of the language, in that language
+func (page *SettingsPage) LanguageName(lang string) string {
+	return languageNames[lang]
+}
+
+// AgoExample previews relative dates of list views
+func (page *SettingsPage) AgoExample() string {
+	return page.Effective.Ago(page.Now.Add(-3*time.Hour), page.Now)
+}
+
+func (page *SettingsPage) Render(w io.Writer) error {
+	return render(settingsTemplate, w, page.Effective.Lang(), page)
+}
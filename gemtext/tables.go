@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// drawTables replaces tables with their ASCII art drawing, in a <pre>
+// followed by the links of their cells. The pretty tables of html2gemini
+// copy the rest of the document in each cell.
+func drawTables(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode && c.DataAtom == atom.Table {
+			pre, links := drawTable(c)
+			n.InsertBefore(pre, c)
+			if links.FirstChild != nil {
+				n.InsertBefore(links, c)
+			}
+			n.RemoveChild(c)
+		} else {
+			drawTables(c)
+		}
+		c = next
+	}
+}
+
+func drawTable(table *html.Node) (pre, links *html.Node) {
+	var header []string
+	var rows [][]string
+	columns := 0
+	links = &html.Node{Type: html.ElementNode, DataAtom: atom.P, Data: "p"}
+
+	for _, tr := range tableRows(table) {
+		var row []string
+		headerOnly := true
+		for cell := tr.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type != html.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) {
+				continue
+			}
+			headerOnly = headerOnly && cell.DataAtom == atom.Th
+			row = append(row, cellText(cell, links))
+		}
+		columns = max(columns, len(row))
+		if headerOnly && header == nil && rows == nil && row != nil {
+			header = row
+		} else {
+			rows = append(rows, row)
+		}
+	}
+
+	var drawing strings.Builder
+	writer := tablewriter.NewWriter(&drawing)
+	writer.SetAutoFormatHeaders(false)
+	writer.SetHeader(padRow(header, columns))
+	for _, row := range rows {
+		writer.Append(padRow(row, columns))
+	}
+	writer.Render()
+
+	pre = &html.Node{Type: html.ElementNode, DataAtom: atom.Pre, Data: "pre"}
+	pre.AppendChild(&html.Node{Type: html.TextNode, Data: strings.TrimSuffix(drawing.String(), "\n")})
+	return pre, links
+}
+
+// tableRows returns the rows of the table, without those of nested tables
+func tableRows(n *html.Node) []*html.Node {
+	var rows []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Tr:
+			rows = append(rows, c)
+		case atom.Table:
+		default:
+			rows = append(rows, tableRows(c)...)
+		}
+	}
+	return rows
+}
+
+// cellText returns the text of the cell on one line, and moves its links to
+// links
+func cellText(n *html.Node, links *html.Node) string {
+	var text strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.Type == html.TextNode:
+				text.WriteString(c.Data)
+				text.WriteString(" ")
+			case c.Type == html.ElementNode && c.DataAtom == atom.A:
+				walk(c)
+				n.RemoveChild(c)
+				links.AppendChild(c)
+			case c.Type == html.ElementNode:
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(text.String()), " ")
+}
+
+func padRow(row []string, columns int) []string {
+	if row == nil {
+		return nil
+	}
+	for len(row) < columns {
+		row = append(row, "")
+	}
+	return row
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"cmp"
+	_ "embed"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+
+	miniflux "miniflux.app/client"
+)
+
+var (
+	//go:embed templates/tags.gmi
+	tagsTxt string
+)
+
+// Tag found in entries, with the number of entries carrying it
+type Tag struct {
+	Name    string
+	Entries int
+	Unread  int
+}
+
+// Params of the article list of the entries with the tag, including the read
+// ones when none is unread
+func (tag *Tag) Params() string {
+	query := url.Values{"tag": {tag.Name}}
+	if tag.Unread == 0 {
+		query["statuses"] = []string{miniflux.EntryStatusUnread, miniflux.EntryStatusRead}
+	}
+	return query.Encode()
+}
+
+// HasTag reports whether the entry carries the tag, ignoring case as feeds
+// don’t agree on it
+func HasTag(entry *miniflux.Entry, tag string) bool {
+	return slices.ContainsFunc(entry.Tags, func(t string) bool {
+		return strings.EqualFold(strings.TrimSpace(t), tag)
+	})
+}
+
+// TagsPage lists the tags of recent entries, the most frequent first
+type TagsPage struct {
+	Tags []*Tag
+	// Number of entries the tags were found in
+	Scanned  int
+	settings Settings
+}
+
+func NewTagsPage(entries miniflux.Entries, settings Settings) *TagsPage {
+	byName := make(map[string]*Tag)
+	for _, entry := range entries {
+		seen := make(map[string]bool)
+		for _, name := range entry.Tags {
+			name = strings.TrimSpace(name)
+			key := strings.ToLower(name)
+			if name == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			tag, ok := byName[key]
+			if !ok {
+				tag = &Tag{Name: name}
+				byName[key] = tag
+			}
+			tag.Entries++
+			if entry.Status == miniflux.EntryStatusUnread {
+				tag.Unread++
+			}
+		}
+	}
+
+	tags := make([]*Tag, 0, len(byName))
+	for _, tag := range byName {
+		tags = append(tags, tag)
+	}
+	slices.SortFunc(tags, func(a, b *Tag) int {
+		if c := cmp.Compare(b.Entries, a.Entries); c != 0 {
+			return c
+		}
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	return &TagsPage{Tags: tags, Scanned: len(entries), settings: settings}
+}
+
+func (page *TagsPage) Render(w io.Writer) error {
+	return render(tagsTemplate, w, page.settings.Lang(), page)
+}
@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+// Templates, named after the file that overrides them in the template
+// directory
+const (
+	homeTemplate       = "home.gmi"
+	entryTemplate      = "entry.gmi"
+	settingsTemplate   = "settings.gmi"
+	conversionTemplate = "conversion.gmi"
+	mediaTemplate      = "media.gmi"
+	readerTemplate     = "reader.gmi"
+	subscribeTemplate  = "subscribe.gmi"
+	feedTemplate       = "feed.gmi"
+	historyTemplate    = "history.gmi"
+	viewsTemplate      = "views.gmi"
+	tagsTemplate       = "tags.gmi"
+)
+
+var defaultTemplates = map[string]string{
+	homeTemplate:       homeTxt,
+	entryTemplate:      entryTxt,
+	settingsTemplate:   settingsTxt,
+	conversionTemplate: conversionTxt,
+	mediaTemplate:      mediaTxt,
+	readerTemplate:     readerTxt,
+	subscribeTemplate:  subscribeTxt,
+	feedTemplate:       feedTxt,
+	historyTemplate:    historyTxt,
+	viewsTemplate:      viewsTxt,
+	tagsTemplate:       tagsTxt,
+}
+
+// Data a template is executed with to validate it. Only the branches taken
+// for this data are checked.
+var templateSamples = map[string]func() any{
+	homeTemplate: func() any {
+		category := &miniflux.Category{ID: 1, Title: "Category"}
+		return &Home{
+			Categories: []*RichCategory{{
+				Category: category,
+				Feeds:    []*miniflux.Feed{{ID: 1, Title: "Feed", Category: category}},
+			}},
+			Views:    []*SavedView{{ID: 1, Name: "View", Filter: url.Values{"feedID": {"1"}}, Unread: 2}},
+			query:    &url.Values{},
+			settings: DefaultSettings(),
+		}
+	},
+	entryTemplate: func() any {
+		category := &miniflux.Category{ID: 1, Title: "Category"}
+		return &TemplatableEntry{
+			Entry: &miniflux.Entry{
+				ID: 1, Status: miniflux.EntryStatusUnread, Title: "Title", URL: "https://example.com",
+				Date: time.Now(), Feed: &miniflux.Feed{ID: 1, Title: "Feed", Category: category},
+				Enclosures: miniflux.Enclosures{{ID: 1, URL: "https://example.com/episode.mp3", MimeType: "audio/mpeg", Size: 1}},
+				Tags:       []string{"Tag"},
+			},
+			MediaProgressions: map[int64]int{1: 60},
+			GeminiContent:     "# Heading\nContent\n",
+			Page:              1,
+			pages:             []string{"# Heading\nContent\n", "## Next heading\nContent\n"},
+			query:             &url.Values{},
+			settings:          DefaultSettings(),
+		}
+	},
+	settingsTemplate: func() any {
+		return NewSettingsPage(DefaultSettings(), DefaultSettings())
+	},
+	conversionTemplate: func() any {
+		feed := &miniflux.Feed{ID: 1, Title: "Feed"}
+		return NewConversionPage(DefaultConversion, url.Values{"links": {"plain"}}, feed, DefaultSettings())
+	},
+	mediaTemplate: func() any {
+		feed := &miniflux.Feed{ID: 1, Title: "Feed"}
+		entry := &miniflux.Entry{
+			ID: 1, Title: "Episode", Date: time.Now(), Feed: feed,
+			Enclosures: miniflux.Enclosures{{ID: 1, URL: "https://example.com/episode.mp3", MimeType: "audio/mpeg", Size: 1}},
+		}
+		return NewMediaPage(miniflux.Entries{entry}, feed, DefaultSettings())
+	},
+	readerTemplate: func() any {
+		return &ReaderPage{
+			URL:           "https://example.com/page",
+			Title:         "Page",
+			GeminiContent: "Content\n",
+			settings:      DefaultSettings(),
+		}
+	},
+	subscribeTemplate: func() any {
+		return NewSubscribePage(
+			"https://example.com",
+			miniflux.Subscriptions{{Title: "Feed", URL: "https://example.com/feed.xml", Type: "atom"}},
+			miniflux.Categories{{ID: 1, Title: "Category"}},
+			DefaultSettings(),
+		)
+	},
+	feedTemplate: func() any {
+		entry := &miniflux.Entry{ID: 1, Title: "Title", Date: time.Now()}
+		base := &url.URL{Scheme: "gemini", Host: "example.com", Path: "/feed.gmi"}
+		return NewEntryFeed(miniflux.Entries{entry}, nil, nil, false, base, DefaultSettings())
+	},
+	historyTemplate: func() any {
+		entry := &miniflux.Entry{ID: 1, Title: "Title", ChangedAt: time.Now(), Feed: &miniflux.Feed{ID: 1, Title: "Feed"}}
+		return NewHistoryPage(miniflux.Entries{entry}, 30, 20, DefaultSettings())
+	},
+	viewsTemplate: func() any {
+		view := &SavedView{ID: 1, Name: "View", Filter: url.Values{"feedID": {"1"}}}
+		return NewViewsPage([]*SavedView{view}, DefaultSettings())
+	},
+	tagsTemplate: func() any {
+		entry := &miniflux.Entry{ID: 1, Status: miniflux.EntryStatusUnread, Tags: []string{"Tag"}}
+		return NewTagsPage(miniflux.Entries{entry}, DefaultSettings())
+	},
+}
+
+type loadedTemplate struct {
+	tmpl *template.Template
+	// Of the file it was loaded from, zero for embedded templates
+	modTime time.Time
+}
+
+// templateSet holds the templates in use, the embedded ones unless
+// LoadTemplates overrode them
+type templateSet struct {
+	mu     sync.RWMutex
+	dir    string
+	reload bool
+	byName map[string]loadedTemplate
+}
+
+var templates = &templateSet{byName: embeddedTemplates()}
+
+func embeddedTemplates() map[string]loadedTemplate {
+	byName := make(map[string]loadedTemplate, len(defaultTemplates))
+	for name, text := range defaultTemplates {
+		byName[name] = loadedTemplate{tmpl: geminiTemplate(name, text)}
+	}
+	return byName
+}
+
+// LoadTemplates overrides the embedded templates with the files of the same
+// name in dir, after checking that they render. With reload, files changed
+// later are loaded again when rendering, for development. An empty dir
+// restores the embedded templates.
+func LoadTemplates(dir string, reload bool) error {
+	byName := embeddedTemplates()
+	if dir != "" {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("error reading template directory: %w", err)
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || !strings.HasSuffix(name, ".gmi") {
+				continue
+			}
+			if _, ok := defaultTemplates[name]; !ok {
+				return fmt.Errorf("unknown template %q in %s", name, dir)
+			}
+
+			loaded, err := loadTemplate(dir, name)
+			if err != nil {
+				return err
+			}
+			byName[name] = loaded
+		}
+	}
+
+	templates.mu.Lock()
+	defer templates.mu.Unlock()
+	templates.dir, templates.reload, templates.byName = dir, reload, byName
+	return nil
+}
+
+// loadTemplate parses the template file and renders it with sample data
+func loadTemplate(dir, name string) (loadedTemplate, error) {
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return loadedTemplate{}, fmt.Errorf("error reading template: %w", err)
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return loadedTemplate{}, fmt.Errorf("error reading template: %w", err)
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(string(text))
+	if err != nil {
+		return loadedTemplate{}, fmt.Errorf("invalid template %s: %w", path, err)
+	}
+	if err := execute(tmpl, io.Discard, DefaultLanguage, templateSamples[name]()); err != nil {
+		return loadedTemplate{}, fmt.Errorf("invalid template %s: %w", path, err)
+	}
+	return loadedTemplate{tmpl: tmpl, modTime: info.ModTime()}, nil
+}
+
+// lookup returns the template called name, loading it again if it changed
+// and reloading is enabled
+func (ts *templateSet) lookup(name string) (*template.Template, error) {
+	ts.mu.RLock()
+	loaded, ok := ts.byName[name]
+	dir, reload := ts.dir, ts.reload
+	ts.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+	if !reload {
+		return loaded.tmpl, nil
+	}
+
+	info, err := os.Stat(filepath.Join(dir, name))
+	if err != nil || info.ModTime().Equal(loaded.modTime) {
+		return loaded.tmpl, nil
+	}
+	reloaded, err := loadTemplate(dir, name)
+	if err != nil {
+		// Keep the working template, without trying again until the file
+		// changes
+		log.Printf("error reloading template, keeping the previous one: %v", err)
+		reloaded = loadedTemplate{tmpl: loaded.tmpl, modTime: info.ModTime()}
+	}
+
+	ts.mu.Lock()
+	ts.byName[name] = reloaded
+	ts.mu.Unlock()
+	return reloaded.tmpl, nil
+}
+
+// render renders the template called name, with the t template function
+// translating to lang
+func render(name string, w io.Writer, lang string, data any) error {
+	tmpl, err := templates.lookup(name)
+	if err != nil {
+		return err
+	}
+	return execute(tmpl, w, lang, data)
+}
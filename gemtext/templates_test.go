@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	miniflux "miniflux.app/client"
+)
+
+func writeTemplate(t *testing.T, dir, name, text string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func renderSettings(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewSettingsPage(DefaultSettings(), DefaultSettings()).Render(&buf); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	return buf.String()
+}
+
+func TestLoadTemplates(t *testing.T) {
+	t.Cleanup(func() { LoadTemplates("", false) })
+
+	dir := t.TempDir()
+	writeTemplate(t, dir, "settings.gmi", `# {{ t "Settings" }} ({{ .PageSize }})`)
+	writeTemplate(t, dir, "notes.txt", "not a template")
+	if err := LoadTemplates(dir, false); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	if got := renderSettings(t); got != "# Settings (20)" {
+		t.Errorf("overridden template rendered %q", got)
+	}
+
+	// Templates without an override stay the embedded ones
+	query := url.Values{}
+	home, err := NewHome(&miniflux.Categories{}, &miniflux.Feeds{}, &query, DefaultSettings())
+	if err != nil {
+		t.Fatalf("NewHome: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := home.Render(&buf); err != nil || !strings.Contains(buf.String(), "# Miniflux -> Gemini") {
+		t.Errorf("home not rendered with the embedded template: %q, %v", buf.String(), err)
+	}
+
+	if err := LoadTemplates("", false); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	if got := renderSettings(t); !strings.Contains(got, "\n# Settings\n") {
+		t.Errorf("embedded template not restored, rendered %q", got)
+	}
+}
+
+func TestLoadTemplatesInvalid(t *testing.T) {
+	t.Cleanup(func() { LoadTemplates("", false) })
+
+	tests := []struct {
+		name, file, text string
+	}{
+		{"syntax", "entry.gmi", "{{ if .Starred }}"},
+		{"unknown field", "entry.gmi", "{{ .Nope }}"},
+		{"unknown function", "home.gmi", "{{ bold .Categories }}"},
+		{"unknown template", "feeds.gmi", "# Feeds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTemplate(t, dir, tt.file, tt.text)
+			err := LoadTemplates(dir, false)
+			if err == nil {
+				t.Fatalf("LoadTemplates accepted %q as %s", tt.text, tt.file)
+			}
+			if !strings.Contains(err.Error(), tt.file) {
+				t.Errorf("error %q doesn’t name the file", err)
+			}
+		})
+	}
+}
+
+func TestTemplatesReload(t *testing.T) {
+	t.Cleanup(func() { LoadTemplates("", false) })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.gmi")
+	writeTemplate(t, dir, "settings.gmi", "first")
+	if err := LoadTemplates(dir, true); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	renderSettings(t)
+
+	// Modification times may not change within the test otherwise
+	later := time.Now().Add(time.Minute)
+	writeTemplate(t, dir, "settings.gmi", "second")
+	os.Chtimes(path, later, later)
+	if got := renderSettings(t); got != "second" {
+		t.Errorf("changed template not reloaded, rendered %q", got)
+	}
+
+	writeTemplate(t, dir, "settings.gmi", "{{ .Nope }}")
+	os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute))
+	if got := renderSettings(t); got != "second" {
+		t.Errorf("invalid template replaced the previous one, rendered %q", got)
+	}
+}
@@ -21,11 +21,28 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 	"text/template"
+
+	miniflux "miniflux.app/client"
 )
 
+// Functions available in all templates
+var templateFuncs = template.FuncMap{
+	// Values from feeds may contain line breaks, which would start a new
+	// gemtext line
+	"oneLine": lineBreaks.Replace,
+	"linkURL": func(u string) string {
+		return strings.ReplaceAll(urlBreaks.Replace(u), " ", "%20")
+	},
+	// Link to a media file, through the server if its media proxy is enabled
+	"media": proxyMedia,
+	// Translates its message to the language of the user, see execute
+	"t": translator(DefaultLanguage),
+}
+
 func geminiTemplate(name, text string) *template.Template {
-	tmpl, err := template.New(name).Parse(text)
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
 	if err != nil {
 		panic(err)
 	}
@@ -82,3 +99,13 @@ func currentOffset(values *url.Values) int {
 	return maxInt(offset, 0)
 }
 
+
+// unreadOnly tells whether the article list of the query only has unread
+// entries. Without parameters, the list has only unread entries
+func unreadOnly(values *url.Values) bool {
+	if _, ok := (*values)["statuses"]; ok {
+		return false
+	}
+	status := values.Get("status")
+	return status == "" || status == miniflux.EntryStatusUnread
+}
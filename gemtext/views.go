@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package gemtext
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+var (
+	//go:embed templates/views.gmi
+	viewsTxt string
+)
+
+// SavedView is a filter of the article list saved by a user under a name
+type SavedView struct {
+	ID     int64
+	Name   string
+	Filter url.Values
+	// Unread entries matching the filter, only counted on the home page
+	Unread int
+	// Whether there may be more, as entries with a tag are only counted among
+	// the most recent ones
+	MoreUnread bool
+}
+
+// Params of the article list of the view
+func (view *SavedView) Params() string {
+	return view.Filter.Encode()
+}
+
+const maxViewName = 100
+
+// ValidViewName trims the name of a view and checks that it fits on a line
+func ValidViewName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, "\r\n") || utf8.RuneCountInString(name) > maxViewName {
+		return "", fmt.Errorf("names must be a line of 1 to %d characters", maxViewName)
+	}
+	return name, nil
+}
+
+// viewKeys are the parameters of the article list kept in saved views, the
+// others being about the position in the list
+var viewKeys = []string{"categoryID", "feedID", "tag", "search", "starred", "status", "statuses", "order", "direction"}
+
+// ViewFilter keeps the parameters of query that select entries
+func ViewFilter(query url.Values) url.Values {
+	filter := url.Values{}
+	for _, key := range viewKeys {
+		if values, ok := query[key]; ok {
+			filter[key] = values
+		}
+	}
+	return filter
+}
+
+// NewViewPath returns the path saving filter as a new view, which takes the
+// name as its query
+func NewViewPath(filter url.Values) string {
+	return "/views/new/" + gemini.QueryEscape(ViewFilter(filter).Encode())
+}
+
+// ViewsPage lists the saved views of a user, to edit and delete them
+type ViewsPage struct {
+	Views    []*SavedView
+	settings Settings
+}
+
+func NewViewsPage(views []*SavedView, settings Settings) *ViewsPage {
+	return &ViewsPage{Views: views, settings: settings}
+}
+
+func (page *ViewsPage) Render(w io.Writer) error {
+	return render(viewsTemplate, w, page.settings.Lang(), page)
+}
@@ -18,76 +18,174 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"cj.rs/miniflux-gemini/gemtext"
 	"git.sr.ht/~adnano/go-gemini"
+	"golang.org/x/net/html/charset"
 	minifluxClient "miniflux.app/client"
 )
 
-func getMiniflux(ctx context.Context, w gemini.ResponseWriter) *minifluxClient.Client {
+func getMiniflux(ctx context.Context, w gemini.ResponseWriter) *MinifluxClient {
 	user, ok := UserFromContext(ctx)
 	if !ok {
-		w.WriteHeader(gemini.StatusPermanentFailure, "Unexpected error")
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Unexpected error"))
 		log.Printf("couldn’t get user")
 		return nil
 	}
 	miniflux := minifluxClient.New(user.instance, user.token)
 	if miniflux == nil {
-		w.WriteHeader(gemini.StatusTemporaryFailure, "Unexpected error")
+		w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "Unexpected error"))
 		log.Println("couldn't create miniflux client")
 		return nil
 	}
-	return miniflux
+	return &MinifluxClient{Client: miniflux, metrics: MetricsFromContext(ctx)}
+}
+
+// getSettings returns the settings of the user, or the default ones
+func getSettings(ctx context.Context) gemtext.Settings {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return gemtext.DefaultSettings()
+	}
+	return user.settings
+}
+
+// language returns the language of the interface for the user. It doesn’t
+// query Miniflux, so that errors can be translated too
+func language(ctx context.Context) string {
+	settings := getSettings(ctx)
+	if user, ok := UserFromContext(ctx); ok && settings.Language == "" {
+		if profile, ok := profiles.cached(user.certFingerprint); ok {
+			settings = settings.WithProfile("", profile.language)
+		}
+	}
+	return settings.Lang()
+}
+
+// translate returns msg in the language of the user
+func translate(ctx context.Context, msg string, args ...any) string {
+	return gemtext.Translate(language(ctx), msg, args...)
+}
+
+// translateError returns the message of err in the language of the user,
+// when it tells why a value entered by the user is refused
+func translateError(ctx context.Context, err error) string {
+	var invalid *gemtext.InvalidValueError
+	if errors.As(err, &invalid) {
+		return invalid.Translate(language(ctx))
+	}
+	return err.Error()
 }
 
 // markAsHandler changes the status of the entry as given
 func markAsHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	markAs(ctx, w, r, r.URL.Query())
+}
+
+// readNextHandler marks the entry as read and goes to the given offset,
+// where the next entry is once this one is read
+func readNextHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
 	query := r.URL.Query()
+	query.Set("_status", minifluxClient.EntryStatusRead)
+	markAs(ctx, w, r, query)
+}
 
+// markAs changes the status of the entry in the query and redirects to the
+// article list of the rest of the query, or to the history when _from is
+// history
+func markAs(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request, query url.Values) {
 	status := query.Get("_status")
 	switch status {
 	case minifluxClient.EntryStatusRead,
 		minifluxClient.EntryStatusUnread:
 		// valid, continue
 	default:
-		w.WriteHeader(gemini.StatusBadRequest, "missing or invalid status")
+		w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "missing or invalid status"))
 		return
 	}
 
-	idString := query.Get("_id")
-	if idString == "" {
-		w.WriteHeader(gemini.StatusBadRequest, "missing id")
+	id, ok := entryIDParam(ctx, w, query)
+	if !ok {
 		return
 	}
-	id, err := strconv.ParseInt(idString, 10, 64)
-	if err != nil {
-		w.WriteHeader(gemini.StatusBadRequest, "invalid id")
-		return
+
+	// Actions from the history go back to it
+	list := "/entry"
+	if query.Get("_from") == "history" {
+		list = "/history"
 	}
 
 	// Remove params for this action, we will pass back the other params
 	query.Del("_status")
 	query.Del("_id")
+	query.Del("_from")
 
 	miniflux := getMiniflux(ctx, w)
 	if miniflux == nil {
 		return
 	}
 
-	err = miniflux.UpdateEntries([]int64{id}, status)
+	err := miniflux.UpdateEntries([]int64{id}, status)
 	if err != nil {
-		w.WriteHeader(gemini.StatusCGIError, "miniflux error")
-		log.Printf("error updating entry %v: %v", id, err)
+		minifluxError(ctx, w, r, err, fmt.Sprintf("updating entry %v", id))
 		return
 	}
 
 	// Save the params and attempt to keep mostly the same position in the
 	// article list (this may get back to the same article if the reading
 	// list has read articles)
+	w.WriteHeader(gemini.StatusRedirect, fmt.Sprintf("%s?%s", list, query.Encode()))
+}
+
+// entryIDParam returns the ID of the entry an action is for, from the _id
+// param of the query
+func entryIDParam(ctx context.Context, w gemini.ResponseWriter, query url.Values) (int64, bool) {
+	idString := query.Get("_id")
+	if idString == "" {
+		w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "missing id"))
+		return 0, false
+	}
+	id, err := strconv.ParseInt(idString, 10, 64)
+	if err != nil {
+		w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid id"))
+		return 0, false
+	}
+	return id, true
+}
+
+// saveHandler sends the entry in the query to the third-party integrations
+// of Miniflux and, like markAs, redirects to the article list of the rest of
+// the query
+func saveHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	query := r.URL.Query()
+	id, ok := entryIDParam(ctx, w, query)
+	if !ok {
+		return
+	}
+	query.Del("_id")
+
+	err := saveEntry(ctx, id)
+	if errors.Is(err, errNoIntegration) {
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "No integration to save entries to is enabled in Miniflux, see Settings > Integrations there"))
+		return
+	}
+	if err != nil {
+		minifluxError(ctx, w, r, err, fmt.Sprintf("saving entry %v", id))
+		return
+	}
+
 	w.WriteHeader(gemini.StatusRedirect, fmt.Sprintf("/entry?%s", query.Encode()))
 }
 
@@ -99,8 +197,7 @@ func refreshAllHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.R
 
 	err := miniflux.RefreshAllFeeds()
 	if err != nil {
-		w.WriteHeader(gemini.StatusCGIError, "miniflux error")
-		log.Printf("error refreshing all feeds: %v", err)
+		minifluxError(ctx, w, r, err, "refreshing all feeds")
 		return
 	}
 
@@ -108,70 +205,806 @@ func refreshAllHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.R
 	w.WriteHeader(gemini.StatusRedirect, "/")
 }
 
-func homeHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+func homeHandler(db *SqliteDB) gemini.HandlerFunc {
+	return func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		miniflux := getMiniflux(ctx, w)
+		if miniflux == nil {
+			return
+		}
+		user, _ := UserFromContext(ctx)
+		settings := effectiveSettings(ctx, miniflux)
+		query := r.URL.Query()
+
+		categories, err := miniflux.Categories()
+		if err != nil {
+			minifluxError(ctx, w, r, err, "getting miniflux categories")
+			return
+		}
+
+		feeds, err := miniflux.Feeds()
+		if err != nil {
+			minifluxError(ctx, w, r, err, "getting miniflux feeds")
+			return
+		}
+
+		views, err := db.GetViews(user.certFingerprint)
+		if err != nil {
+			// The rest of the home page is still useful
+			log.Printf("error getting saved views: %v", err)
+		}
+
+		var counters *minifluxClient.FeedCounters
+		if settings.HideEmptyFeeds || slices.ContainsFunc(views, func(view *gemtext.SavedView) bool {
+			_, _, ok := counterFilter(view.Filter)
+			return ok
+		}) {
+			counters, err = miniflux.FetchCounters()
+			if err != nil {
+				if settings.HideEmptyFeeds {
+					minifluxError(ctx, w, r, err, "getting miniflux feed counters")
+					return
+				}
+				// Views are then counted one by one
+				log.Printf("error getting miniflux feed counters: %v", err)
+				counters = nil
+			}
+		}
+		countViews(miniflux, settings, views, feeds, counters)
+
+		if settings.HideEmptyFeeds {
+			feeds = slices.DeleteFunc(feeds, func(feed *minifluxClient.Feed) bool {
+				return counters.UnreadCounters[feed.ID] == 0
+			})
+		}
+
+		gemtextHome, err := gemtext.NewHome(&categories, &feeds, &query, settings)
+		gemtextHome.Views = views
+		err = gemtextHome.Render(w)
+		if err != nil {
+			log.Printf("error rendering home template: %v", err)
+			return
+		}
+	}
+}
+
+func entryHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
 	miniflux := getMiniflux(ctx, w)
 	if miniflux == nil {
 		return
 	}
+	settings := effectiveSettings(ctx, miniflux)
+	articleList := NewArticleList(settings)
+
 	query := r.URL.Query()
+	articleList.Extend(query)
+
+	// Pages of an entry split in several point to the entry itself, as it
+	// may have moved in the list since its first page was shown
+	page, _ := strconv.Atoi(query.Get("page"))
+	entryID, _ := strconv.ParseInt(query.Get("entryID"), 10, 64)
+	full := query.Get("full") == "true"
+	query.Del("page")
+	query.Del("entryID")
+	query.Del("full")
+
+	var entry *minifluxClient.Entry
+	var err error
+	if entryID != 0 {
+		entry, err = miniflux.Entry(entryID)
+	} else {
+		entry, err = articleList.First(miniflux)
+	}
+	if err != nil {
+		minifluxError(ctx, w, r, err, "getting miniflux entries")
+		return
+	}
+	if entry == nil && articleList.ScanCut {
+		w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "No entry returned among the %d most recent ones, which are the only ones looked at for tags", maxTagScan))
+		return
+	}
+	if entry == nil {
+		w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "No entry returned"))
+		return
+	}
+
+	// Entries are opened on their first page, from the list or from links to
+	// them, like in subscription feeds. Links to other pages and to the full
+	// article are followed from an entry that was already opened
+	opened := page <= 1 && !full
+	if settings.AutoMarkRead == gemtext.AutoMarkReadOpen && entry.Status == minifluxClient.EntryStatusUnread && opened {
+		// Not being able to mark the entry shouldn’t prevent reading it
+		err = miniflux.UpdateEntries([]int64{entry.ID}, minifluxClient.EntryStatusRead)
+		if err != nil {
+			log.Printf("error marking entry %v as read on open: %v", entry.ID, err)
+		} else {
+			entry.Status = minifluxClient.EntryStatusRead
+		}
+	}
+
+	settings.Conversion = feedConversion(ctx, settings, entry.FeedID)
+	fetched := false
+	if full || settings.Conversion.FullContent {
+		content, err := fetchContent(ctx, entry.ID)
+		switch {
+		case err != nil && full:
+			minifluxError(ctx, w, r, err, fmt.Sprintf("fetching the content of entry %v", entry.ID))
+			return
+		case err != nil:
+			// The summary of the feed is better than nothing
+			log.Printf("error fetching the content of entry %v: %v", entry.ID, err)
+		default:
+			entry.Content, fetched = content, true
+		}
+	}
+
+	gemtextEntry, err := gemtext.NewTemplatableEntry(entry, &query, page, settings)
+	if err != nil {
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Unexpected error"))
+		log.Printf("error templating entry: %v", err)
+		return
+	}
+	gemtextEntry.Full = fetched
+	if len(entry.Enclosures) > 0 {
+		// Without them, enclosures are still listed
+		gemtextEntry.MediaProgressions, err = mediaProgressions(ctx, entry.ID)
+		if err != nil {
+			log.Printf("error getting media progressions of entry %v: %v", entry.ID, err)
+		}
+	}
+	err = gemtextEntry.Render(w)
+	if err != nil {
+		log.Printf("error rendering entry: %v", err)
+		return
+	}
+}
 
+// Clients wait for the page while it is fetched
+const readTimeout = 10 * time.Second
+
+// readHandler converts the web page in the query to gemtext, for links of
+// entries that lead out of Gemini
+func readHandler(reader fetcher) gemini.HandlerFunc {
+	return func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		if r.URL.RawQuery == "" {
+			w.WriteHeader(gemini.StatusInput, translate(ctx, "URL of the web page to read"))
+			return
+		}
+		target, ok := webURL(r.URL.RawQuery)
+		if !ok {
+			w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid URL"))
+			return
+		}
+
+		miniflux := getMiniflux(ctx, w)
+		if miniflux == nil {
+			return
+		}
+		settings := effectiveSettings(ctx, miniflux)
+		user, _ := UserFromContext(ctx)
+
+		fetchCtx, cancel := context.WithTimeout(ctx, readTimeout)
+		defer cancel()
+		mediaType, body, err := reader.fetch(fetchCtx, target, user.instance)
+		switch {
+		case errors.Is(err, errTooLarge):
+			w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "The page is too large"))
+			return
+		case errors.Is(err, errForbiddenType):
+			// Other files can still be opened directly
+			w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Only web pages can be read"))
+			return
+		case err != nil:
+			w.WriteHeader(gemini.StatusProxyError, translate(ctx, "Couldn’t get the page"))
+			log.Printf("%s: error reading %q: %v", shortFingerprint(user.certFingerprint), target, err)
+			return
+		}
+
+		// Pages declare their encoding in the Content-Type or in the HTML
+		decoded, err := charset.NewReader(bytes.NewReader(body), mediaType)
+		if err == nil {
+			body, err = io.ReadAll(decoded)
+		}
+		if err != nil {
+			w.WriteHeader(gemini.StatusProxyError, translate(ctx, "Couldn’t get the page"))
+			log.Printf("%s: error decoding %q: %v", shortFingerprint(user.certFingerprint), target, err)
+			return
+		}
+
+		page, err := gemtext.NewReaderPage(target, string(body), settings)
+		if err != nil {
+			w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Unexpected error"))
+			log.Printf("error converting %q: %v", target, err)
+			return
+		}
+		if err := page.Render(w); err != nil {
+			log.Printf("error rendering page: %v", err)
+			return
+		}
+	}
+}
+
+// webURL unescapes the http(s) URL of a query
+func webURL(rawQuery string) (string, bool) {
+	target, err := gemini.QueryUnescape(rawQuery)
+	if err != nil {
+		return "", false
+	}
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// subscribeHandler lists the feeds Miniflux finds on the web page in the
+// query, to subscribe to one of them
+func subscribeHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	if r.URL.RawQuery == "" {
+		w.WriteHeader(gemini.StatusInput, translate(ctx, "URL of the site to subscribe to"))
+		return
+	}
+	target, ok := webURL(r.URL.RawQuery)
+	if !ok {
+		w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid URL"))
+		return
+	}
+
+	miniflux := getMiniflux(ctx, w)
+	if miniflux == nil {
+		return
+	}
+	settings := effectiveSettings(ctx, miniflux)
+
+	// Miniflux answers not found when there is no feed
+	subscriptions, err := miniflux.Discover(target)
+	if err != nil && !errors.Is(err, minifluxClient.ErrNotFound) {
+		minifluxError(ctx, w, r, err, fmt.Sprintf("discovering feeds of %q", target))
+		return
+	}
 	categories, err := miniflux.Categories()
 	if err != nil {
-		w.WriteHeader(gemini.StatusTemporaryFailure, "Error querying minflux")
-		log.Printf("error getting miniflux categories: %v", err)
+		minifluxError(ctx, w, r, err, "getting miniflux categories")
+		return
+	}
+
+	err = gemtext.NewSubscribePage(target, subscriptions, categories, settings).Render(w)
+	if err != nil {
+		log.Printf("error rendering subscriptions: %v", err)
 		return
 	}
+}
 
-	feeds, err := miniflux.Feeds()
+// createFeedHandler subscribes to the feed in the query, in the category of
+// the path, and shows its entries
+func createFeedHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	categoryID, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/subscribe/"), 10, 64)
 	if err != nil {
-		w.WriteHeader(gemini.StatusTemporaryFailure, "Error querying minflux")
-		log.Printf("error getting miniflux feeds: %v", err)
+		w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid category"))
+		return
+	}
+	feedURL, ok := webURL(r.URL.RawQuery)
+	if !ok {
+		w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid URL"))
 		return
 	}
 
-	gemtextHome, err := gemtext.NewHome(&categories, &feeds, &query)
-	err = gemtextHome.Render(w)
+	miniflux := getMiniflux(ctx, w)
+	if miniflux == nil {
+		return
+	}
+
+	feedID, err := miniflux.CreateFeed(&minifluxClient.FeedCreationRequest{
+		FeedURL:    feedURL,
+		CategoryID: categoryID,
+	})
 	if err != nil {
-		log.Printf("error rendering home template: %v", err)
+		minifluxError(ctx, w, r, err, fmt.Sprintf("subscribing to %q", feedURL))
 		return
 	}
+
+	w.WriteHeader(gemini.StatusRedirect, fmt.Sprintf("/entry?feedID=%d", feedID))
 }
 
-func entryHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
-	articleList := NewArticleList()
+// historyHandler lists read entries, the ones read last first, from the
+// offset in the query
+func historyHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
 	miniflux := getMiniflux(ctx, w)
 	if miniflux == nil {
 		return
 	}
+	settings := effectiveSettings(ctx, miniflux)
 
-	query := r.URL.Query()
-	articleList.Extend(query)
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	offset = max(offset, 0)
+	entries, err := miniflux.Entries(&minifluxClient.Filter{
+		Status:    minifluxClient.EntryStatusRead,
+		Order:     "changed_at",
+		Direction: "desc",
+		Offset:    offset,
+		Limit:     settings.PageSize,
+	})
+	if err != nil {
+		minifluxError(ctx, w, r, err, "getting read entries")
+		return
+	}
 
-	entry, err := articleList.First(miniflux)
+	err = gemtext.NewHistoryPage(entries.Entries, entries.Total, offset, settings).Render(w)
 	if err != nil {
-		w.WriteHeader(gemini.StatusTemporaryFailure, "Error querying minflux")
-		log.Printf("error getting miniflux entries: %v", err)
+		log.Printf("error rendering history: %v", err)
 		return
 	}
-	if entry == nil {
-		w.WriteHeader(gemini.StatusTemporaryFailure, "No entry returned")
+}
+
+// Most recent entries the tags are listed from
+const maxTagEntries = 500
+
+// tagsHandler lists the tags of the most recent entries, read or not, linking
+// to their article lists
+func tagsHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	miniflux := getMiniflux(ctx, w)
+	if miniflux == nil {
 		return
 	}
+	settings := effectiveSettings(ctx, miniflux)
 
-	gemtextEntry, err := gemtext.NewTemplatableEntry(entry, &query)
+	entries, err := miniflux.Entries(&minifluxClient.Filter{
+		Statuses:  []string{minifluxClient.EntryStatusUnread, minifluxClient.EntryStatusRead},
+		Order:     "published_at",
+		Direction: "desc",
+		Limit:     maxTagEntries,
+	})
 	if err != nil {
-		w.WriteHeader(gemini.StatusPermanentFailure, "Unexpected error")
-		log.Printf("error templating entry: %v", err)
+		minifluxError(ctx, w, r, err, "getting recent entries")
 		return
 	}
-	err = gemtextEntry.Render(w)
+
+	err = gemtext.NewTagsPage(entries.Entries, settings).Render(w)
 	if err != nil {
-		log.Printf("error rendering entry: %v", err)
+		log.Printf("error rendering tags: %v", err)
+		return
+	}
+}
+
+// Entries subscription feeds list at most
+const maxFeedEntries = 100
+
+// entryFeedHandler lists the entries of the filter in the query, unread ones
+// by default, for the feed readers of Gemini clients. They get gemtext
+// following the “Subscribing to Gemini pages” convention or, with atom, an
+// Atom feed
+func entryFeedHandler(atom bool) gemini.HandlerFunc {
+	return func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		miniflux := getMiniflux(ctx, w)
+		if miniflux == nil {
+			return
+		}
+		settings := effectiveSettings(ctx, miniflux)
+		articleList := NewArticleList(settings)
+		articleList.Extend(r.URL.Query())
+		if articleList.Limit <= 0 || articleList.Limit > maxFeedEntries {
+			articleList.Limit = maxFeedEntries
+		}
+
+		// To name the feed after the filter
+		var feed *minifluxClient.Feed
+		var category *minifluxClient.Category
+		var err error
+		switch {
+		case articleList.FeedID != 0:
+			feed, err = miniflux.Feed(articleList.FeedID)
+			if err != nil {
+				minifluxError(ctx, w, r, err, fmt.Sprintf("getting feed %d", articleList.FeedID))
+				return
+			}
+		case articleList.CategoryID != 0:
+			categories, err := miniflux.Categories()
+			if err != nil {
+				minifluxError(ctx, w, r, err, "getting miniflux categories")
+				return
+			}
+			if i := slices.IndexFunc(categories, func(c *minifluxClient.Category) bool { return c.ID == articleList.CategoryID }); i >= 0 {
+				category = categories[i]
+			}
+		}
+
+		entries, err := articleList.Entries(miniflux)
+		if err != nil {
+			minifluxError(ctx, w, r, err, "getting miniflux entries")
+			return
+		}
+
+		page := gemtext.NewEntryFeed(entries.Entries, feed, category, articleList.Starred == "true", r.URL, settings)
+		if articleList.ScanCut {
+			page.ScanLimit = maxTagScan
+		}
+		if atom {
+			w.SetMediaType("application/atom+xml")
+			err = page.RenderAtom(w)
+		} else {
+			err = page.Render(w)
+		}
+		if err != nil {
+			log.Printf("error rendering entry feed: %v", err)
+			return
+		}
+	}
+}
+
+// Entries looked at for enclosures in the media view, as Miniflux can’t
+// filter on them
+const mediaScanned = 100
+
+// mediaHandler lists recent entries with enclosures, of the feed in the
+// query or of all feeds
+func mediaHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	miniflux := getMiniflux(ctx, w)
+	if miniflux == nil {
+		return
+	}
+	settings := effectiveSettings(ctx, miniflux)
+
+	filter := minifluxClient.Filter{Order: "published_at", Direction: "desc", Limit: mediaScanned}
+	var feed *minifluxClient.Feed
+	if idString := r.URL.Query().Get("feedID"); idString != "" {
+		id, err := strconv.ParseInt(idString, 10, 64)
+		if err != nil {
+			w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid feed"))
+			return
+		}
+		feed, err = miniflux.Feed(id)
+		if err != nil {
+			minifluxError(ctx, w, r, err, fmt.Sprintf("getting feed %d", id))
+			return
+		}
+		filter.FeedID = id
+	}
+
+	entries, err := miniflux.Entries(&filter)
+	if err != nil {
+		minifluxError(ctx, w, r, err, "getting miniflux entries")
+		return
+	}
+
+	err = gemtext.NewMediaPage(entries.Entries, feed, settings).Render(w)
+	if err != nil {
+		log.Printf("error rendering media: %v", err)
+		return
+	}
+}
+
+func settingsHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	miniflux := getMiniflux(ctx, w)
+	if miniflux == nil {
+		return
+	}
+
+	err := gemtext.NewSettingsPage(getSettings(ctx), effectiveSettings(ctx, miniflux)).Render(w)
+	if err != nil {
+		log.Printf("error rendering settings: %v", err)
+		return
+	}
+}
+
+// settingHandler asks for the value of the setting in the path and saves it
+func settingHandler(db *SqliteDB) gemini.HandlerFunc {
+	return func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/settings/")
+		prompt, ok := gemtext.SettingPrompt(key, language(ctx))
+		if !ok {
+			w.WriteHeader(gemini.StatusNotFound, translate(ctx, "Unknown setting"))
+			return
+		}
+
+		if r.URL.RawQuery == "" {
+			w.WriteHeader(gemini.StatusInput, prompt)
+			return
+		}
+		value, err := gemini.QueryUnescape(r.URL.RawQuery)
+		if err != nil {
+			w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid value"))
+			return
+		}
+
+		user, ok := UserFromContext(ctx)
+		if !ok {
+			w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Unexpected error"))
+			log.Printf("couldn’t get user")
+			return
+		}
+		settings := user.settings
+		if err := settings.Set(key, value); err != nil {
+			w.WriteHeader(gemini.StatusBadRequest, translateError(ctx, err))
+			return
+		}
+		if err := db.SaveSettings(user.certFingerprint, settings); err != nil {
+			w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "Error saving settings"))
+			log.Printf("error saving settings: %v", err)
+			return
+		}
+
+		w.WriteHeader(gemini.StatusRedirect, "/settings")
+	}
+}
+
+// feedConversion returns the conversion options of the user for the feed
+func feedConversion(ctx context.Context, settings gemtext.Settings, feedID int64) gemtext.ConversionOptions {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return settings.Conversion
+	}
+	options, err := settings.Conversion.With(user.conversions[feedID])
+	if err != nil {
+		log.Printf("error applying conversion options of feed %d: %v", feedID, err)
+	}
+	return options
+}
+
+// conversionHandler shows the conversion options of the user, for all feeds
+// or for the one in the path, and saves the option given after them
+func conversionHandler(db *SqliteDB) gemini.HandlerFunc {
+	return func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		user, ok := UserFromContext(ctx)
+		if !ok {
+			w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Unexpected error"))
+			log.Printf("couldn’t get user")
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/conversion/")
+		var feedID int64
+		if rest, ok := strings.CutPrefix(key, "feed/"); ok {
+			idString, feedKey, _ := strings.Cut(rest, "/")
+			id, err := strconv.ParseInt(idString, 10, 64)
+			if err != nil || id <= 0 {
+				w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid feed"))
+				return
+			}
+			feedID, key = id, feedKey
+		}
+		if key == "" {
+			conversionPage(ctx, w, r, feedID)
+			return
+		}
+
+		prompt, ok := gemtext.ConversionPrompt(key, language(ctx))
+		if !ok {
+			w.WriteHeader(gemini.StatusNotFound, translate(ctx, "Unknown option"))
+			return
+		}
+		if r.URL.RawQuery == "" {
+			w.WriteHeader(gemini.StatusInput, prompt)
+			return
+		}
+		value, err := gemini.QueryUnescape(r.URL.RawQuery)
+		if err != nil {
+			w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid value"))
+			return
+		}
+
+		overrides := url.Values{}
+		maps.Copy(overrides, user.conversions[feedID])
+		if value == "default" {
+			overrides.Del(key)
+		} else {
+			options := gemtext.DefaultConversion
+			if err := options.Set(key, value); err != nil {
+				w.WriteHeader(gemini.StatusBadRequest, translateError(ctx, err))
+				return
+			}
+			overrides.Set(key, strings.TrimSpace(value))
+		}
+		if err := db.SaveConversion(user.certFingerprint, feedID, overrides); err != nil {
+			w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "Error saving settings"))
+			log.Printf("error saving conversion options: %v", err)
+			return
+		}
+
+		w.WriteHeader(gemini.StatusRedirect, strings.TrimSuffix(r.URL.Path, key))
+	}
+}
+
+// conversionPage renders the conversion options for the feed, or for all
+// feeds if feedID is 0
+func conversionPage(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request, feedID int64) {
+	miniflux := getMiniflux(ctx, w)
+	if miniflux == nil {
+		return
+	}
+	user, _ := UserFromContext(ctx)
+	settings := effectiveSettings(ctx, miniflux)
+
+	var feed *minifluxClient.Feed
+	options := settings.Conversion
+	if feedID != 0 {
+		var err error
+		feed, err = miniflux.Feed(feedID)
+		if err != nil {
+			minifluxError(ctx, w, r, err, fmt.Sprintf("getting feed %d", feedID))
+			return
+		}
+		options = feedConversion(ctx, settings, feedID)
+	}
+
+	err := gemtext.NewConversionPage(options, user.conversions[feedID], feed, settings).Render(w)
+	if err != nil {
+		log.Printf("error rendering conversion options: %v", err)
 		return
 	}
 }
 
 func todoHandler(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
-	w.WriteHeader(gemini.StatusTemporaryFailure, "Not implemented")
+	w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "Not implemented"))
 }
 
+// countUnread returns the number of unread entries matching the filter of
+// the article list, and whether there may be more, for the ones with a tag
+func countUnread(miniflux *MinifluxClient, settings gemtext.Settings, filter url.Values) (int, bool, error) {
+	articleList := NewArticleList(settings)
+	articleList.Extend(filter)
+	articleList.Status = minifluxClient.EntryStatusUnread
+	articleList.Statuses = nil
+	count, err := articleList.Count(miniflux)
+	return count, articleList.ScanCut, err
+}
+
+// counterFilter returns the feed or the category filter selects unread
+// entries of, when it selects nothing else, so that they can be counted from
+// the feed counters
+func counterFilter(filter url.Values) (feedID, categoryID int64, ok bool) {
+	for key := range filter {
+		switch key {
+		case "feedID", "categoryID", "status", "statuses", "order", "direction":
+		default:
+			return 0, 0, false
+		}
+	}
+	feedID, feedErr := strconv.ParseInt(filter.Get("feedID"), 10, 64)
+	categoryID, categoryErr := strconv.ParseInt(filter.Get("categoryID"), 10, 64)
+	if (feedErr == nil) == (categoryErr == nil) {
+		return 0, 0, false
+	}
+	return feedID, categoryID, true
+}
+
+// countViews sets the number of unread entries of the views. Views of a feed
+// or a category are counted from counters, unless nil, and the others with a
+// Miniflux request each: users have a handful of views, and counts by tag
+// read maxTagCount entries at most
+func countViews(miniflux *MinifluxClient, settings gemtext.Settings, views []*gemtext.SavedView, feeds minifluxClient.Feeds, counters *minifluxClient.FeedCounters) {
+	for _, view := range views {
+		feedID, categoryID, ok := counterFilter(view.Filter)
+		if !ok || counters == nil {
+			var err error
+			view.Unread, view.MoreUnread, err = countUnread(miniflux, settings, view.Filter)
+			if err != nil {
+				log.Printf("error counting unread entries of view %d: %v", view.ID, err)
+			}
+			continue
+		}
+		if feedID != 0 {
+			view.Unread = counters.UnreadCounters[feedID]
+			continue
+		}
+		view.Unread = 0
+		for _, feed := range feeds {
+			if feed.Category != nil && feed.Category.ID == categoryID {
+				view.Unread += counters.UnreadCounters[feed.ID]
+			}
+		}
+	}
+}
+
+// viewsHandler lists the saved views under /views and edits them under
+// /views/new/<filter>?<name> and /views/<id>/<name|filter|delete>?<value>
+func viewsHandler(db *SqliteDB) gemini.HandlerFunc {
+	return func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		user, ok := UserFromContext(ctx)
+		if !ok {
+			w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Unexpected error"))
+			log.Printf("couldn’t get user")
+			return
+		}
+		views, err := db.GetViews(user.certFingerprint)
+		if err != nil {
+			w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "Error reading saved views"))
+			log.Printf("error getting saved views: %v", err)
+			return
+		}
+
+		path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/views"), "/")
+		if path == "" {
+			miniflux := getMiniflux(ctx, w)
+			if miniflux == nil {
+				return
+			}
+			err := gemtext.NewViewsPage(views, effectiveSettings(ctx, miniflux)).Render(w)
+			if err != nil {
+				log.Printf("error rendering views template: %v", err)
+			}
+			return
+		}
+
+		var view *gemtext.SavedView
+		var action string
+		if filter, ok := strings.CutPrefix(path, "new/"); ok {
+			values, err := url.ParseQuery(filter)
+			if err != nil {
+				w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid filter"))
+				return
+			}
+			view, action = &gemtext.SavedView{Filter: gemtext.ViewFilter(values)}, "name"
+		} else {
+			idString, viewAction, _ := strings.Cut(path, "/")
+			id, err := strconv.ParseInt(idString, 10, 64)
+			if err == nil {
+				i := slices.IndexFunc(views, func(view *gemtext.SavedView) bool { return view.ID == id })
+				if i >= 0 {
+					view = views[i]
+				}
+			}
+			if view == nil {
+				w.WriteHeader(gemini.StatusNotFound, translate(ctx, "Unknown view"))
+				return
+			}
+			action = viewAction
+		}
+
+		var prompt string
+		switch action {
+		case "name":
+			prompt = translate(ctx, "Name of the view")
+		case "filter":
+			prompt = translate(ctx, "Filter of the view, as a query like feedID=1&starred=true")
+		case "delete":
+			prompt = fmt.Sprintf(translate(ctx, "Type “%s” to delete the view %s"), translate(ctx, "yes"), view.Name)
+		default:
+			w.WriteHeader(gemini.StatusNotFound, translate(ctx, "Unknown action"))
+			return
+		}
+		if r.URL.RawQuery == "" {
+			w.WriteHeader(gemini.StatusInput, prompt)
+			return
+		}
+		value, err := gemini.QueryUnescape(r.URL.RawQuery)
+		if err != nil {
+			w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid value"))
+			return
+		}
+
+		switch action {
+		case "name":
+			view.Name, err = gemtext.ValidViewName(value)
+			if err != nil {
+				w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "Names must be a line of 1 to 100 characters"))
+				return
+			}
+			err = db.SaveView(user.certFingerprint, view)
+		case "filter":
+			filter, parseErr := url.ParseQuery(strings.TrimSpace(value))
+			if parseErr != nil {
+				w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "invalid filter"))
+				return
+			}
+			view.Filter = gemtext.ViewFilter(filter)
+			err = db.SaveView(user.certFingerprint, view)
+		case "delete":
+			if !strings.EqualFold(strings.TrimSpace(value), translate(ctx, "yes")) {
+				w.WriteHeader(gemini.StatusRedirect, "/views")
+				return
+			}
+			err = db.DeleteView(user.certFingerprint, view.ID)
+		}
+		switch {
+		case errors.Is(err, ErrViewNotFound):
+			// Deleted in the meantime
+			w.WriteHeader(gemini.StatusNotFound, translate(ctx, "Unknown view"))
+			return
+		case err != nil:
+			w.WriteHeader(gemini.StatusTemporaryFailure, translate(ctx, "Error saving the view"))
+			log.Printf("error saving view: %v", err)
+			return
+		}
+
+		w.WriteHeader(gemini.StatusRedirect, "/views")
+	}
+}
@@ -0,0 +1,880 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"cj.rs/miniflux-gemini/gemtext"
+	"git.sr.ht/~adnano/go-gemini"
+	minifluxClient "miniflux.app/client"
+)
+
+func TestCertificateRequired(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.get(t, "/", nil)
+	if resp.Status != gemini.StatusCertificateRequired {
+		t.Errorf("status = %d, want %d", resp.Status, gemini.StatusCertificateRequired)
+	}
+}
+
+func TestUnknownCertificate(t *testing.T) {
+	h := newHarness(t)
+	unknown := newCertificate(t, "unknown")
+
+	resp, _ := h.get(t, "/", &unknown)
+	if resp.Status != gemini.StatusCertificateNotAuthorized {
+		t.Errorf("status = %d, want %d", resp.Status, gemini.StatusCertificateNotAuthorized)
+	}
+	if !strings.Contains(resp.Meta, fingerprint(unknown.Leaf)) {
+		t.Errorf("meta %q doesn’t contain the fingerprint to enroll", resp.Meta)
+	}
+}
+
+func TestRevokedToken(t *testing.T) {
+	h := newHarness(t)
+	revoked := newCertificate(t, "revoked")
+	h.enroll(t, revoked, h.instance, "revoked-token")
+
+	resp, _ := h.get(t, "/", &revoked)
+	if resp.Status != gemini.StatusCertificateNotAuthorized {
+		t.Errorf("status = %d, want %d", resp.Status, gemini.StatusCertificateNotAuthorized)
+	}
+}
+
+func TestHome(t *testing.T) {
+	h := newHarness(t)
+
+	resp, body := h.get(t, "/", &h.cert)
+	if resp.Status != gemini.StatusSuccess {
+		t.Fatalf("status = %d %q, want success", resp.Status, resp.Meta)
+	}
+	for _, want := range []string{
+		"=> /entry?categoryID=1 Tech",
+		"=> /entry?categoryID=2 Misc",
+		"### Tech",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("home doesn’t contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestEntry(t *testing.T) {
+	h := newHarness(t)
+
+	resp, body := h.get(t, "/entry", &h.cert)
+	if resp.Status != gemini.StatusSuccess {
+		t.Fatalf("status = %d %q, want success", resp.Status, resp.Meta)
+	}
+	for _, want := range []string{
+		"# First post",
+		"Alice",
+		"=> /mark_as?_id=100&_status=read ✓ Mark read",
+		"=> /entry?offset=1 » Next",
+		"=> /entry?feedID=10 🔖 A blog",
+		"=> https://blog.example/first Original page",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("entry doesn’t contain %q:\n%s", want, body)
+		}
+	}
+
+	resp, body = h.get(t, "/entry?offset=1", &h.cert)
+	if resp.Status != gemini.StatusSuccess {
+		t.Fatalf("status = %d %q, want success", resp.Status, resp.Meta)
+	}
+	if !strings.Contains(body, "# Breaking news") || !strings.Contains(body, "⭐") {
+		t.Errorf("second entry isn’t the starred one:\n%s", body)
+	}
+}
+
+func TestEntryStarred(t *testing.T) {
+	h := newHarness(t)
+
+	_, body := h.get(t, "/entry?starred=true&statuses=unread&statuses=read", &h.cert)
+	if !strings.Contains(body, "# Breaking news") {
+		t.Errorf("first starred entry isn’t the starred one:\n%s", body)
+	}
+}
+
+func TestMarkAs(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.get(t, "/mark_as?_id=100&_status=read&feedID=10", &h.cert)
+	if resp.Status != gemini.StatusRedirect {
+		t.Fatalf("status = %d %q, want redirect", resp.Status, resp.Meta)
+	}
+	if resp.Meta != "/entry?feedID=10" {
+		t.Errorf("redirect = %q, want the article list without the action parameters", resp.Meta)
+	}
+	if status := h.miniflux.entries[0].Status; status != minifluxClient.EntryStatusRead {
+		t.Errorf("entry status = %q, want read", status)
+	}
+
+	resp, _ = h.get(t, "/mark_as?_id=100&_status=starred", &h.cert)
+	if resp.Status != gemini.StatusBadRequest {
+		t.Errorf("status = %d for an invalid status, want %d", resp.Status, gemini.StatusBadRequest)
+	}
+}
+
+func TestSaveEntry(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.get(t, "/save?_id=100&feedID=10&offset=1", &h.cert)
+	if resp.Status != gemini.StatusRedirect || resp.Meta != "/entry?feedID=10&offset=1" {
+		t.Fatalf("response = %d %q, want a redirect to the article list", resp.Status, resp.Meta)
+	}
+	if !slices.Equal(h.miniflux.saved, []int64{100}) {
+		t.Errorf("saved entries = %v, want [100]", h.miniflux.saved)
+	}
+
+	resp, _ = h.get(t, "/save?feedID=10", &h.cert)
+	if resp.Status != gemini.StatusBadRequest {
+		t.Errorf("status = %d without id, want %d", resp.Status, gemini.StatusBadRequest)
+	}
+
+	h.miniflux.noIntegration = true
+	resp, _ = h.get(t, "/save?_id=100", &h.cert)
+	if resp.Status != gemini.StatusPermanentFailure || !strings.Contains(resp.Meta, "Integrations") {
+		t.Errorf("response = %d %q without integration, want a failure explaining it", resp.Status, resp.Meta)
+	}
+}
+
+func TestRefreshAll(t *testing.T) {
+	h := newHarness(t)
+
+	if err := h.client().RefreshAllFeeds(); err != nil {
+		t.Fatalf("RefreshAllFeeds: %v", err)
+	}
+	h.miniflux.mu.Lock()
+	defer h.miniflux.mu.Unlock()
+	if h.miniflux.refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", h.miniflux.refreshes)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.get(t, "/settings/timezone", &h.cert)
+	if resp.Status != gemini.StatusInput {
+		t.Fatalf("status = %d, want a prompt", resp.Status)
+	}
+	resp, _ = h.get(t, "/settings/order?bogus", &h.cert)
+	if resp.Status != gemini.StatusBadRequest {
+		t.Errorf("status = %d for an invalid order, want %d", resp.Status, gemini.StatusBadRequest)
+	}
+	resp, _ = h.get(t, "/settings/unknown?1", &h.cert)
+	if resp.Status != gemini.StatusNotFound {
+		t.Errorf("status = %d for an unknown setting, want %d", resp.Status, gemini.StatusNotFound)
+	}
+
+	for _, path := range []string{
+		"/settings/timezone?Europe%2FParis",
+		"/settings/date_format?2006-01-02%2015:04",
+		"/settings/hide_empty_feeds?true",
+	} {
+		resp, _ = h.get(t, path, &h.cert)
+		if resp.Status != gemini.StatusRedirect || resp.Meta != "/settings" {
+			t.Fatalf("%s: response = %d %q, want a redirect to the settings", path, resp.Status, resp.Meta)
+		}
+	}
+
+	_, body := h.get(t, "/settings", &h.cert)
+	if !strings.Contains(body, "Timezone: Europe/Paris\n") {
+		t.Errorf("settings don’t show the new timezone:\n%s", body)
+	}
+	_, body = h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "2024-03-14 16:09") {
+		t.Errorf("entry date isn’t in the new format and timezone:\n%s", body)
+	}
+
+	h.miniflux.mu.Lock()
+	h.miniflux.entries[1].Status = minifluxClient.EntryStatusRead
+	h.miniflux.mu.Unlock()
+	_, body = h.get(t, "/", &h.cert)
+	if strings.Contains(body, "Some news") || !strings.Contains(body, "A blog") {
+		t.Errorf("home doesn’t hide only the feed without unread entries:\n%s", body)
+	}
+}
+
+func TestProfileDates(t *testing.T) {
+	h := newHarness(t)
+	h.miniflux.mu.Lock()
+	h.miniflux.me.Language = "fr_FR"
+	h.miniflux.mu.Unlock()
+
+	_, body := h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "mars 14 2024") {
+		t.Errorf("entry date isn’t in the language of the Miniflux profile:\n%s", body)
+	}
+	_, body = h.get(t, "/settings", &h.cert)
+	if !strings.Contains(body, "Fuseau horaire : America/New_York, celui de votre profil Miniflux") {
+		t.Errorf("settings don’t show the timezone of the Miniflux profile:\n%s", body)
+	}
+
+	h.get(t, "/settings/language?de", &h.cert)
+	h.get(t, "/settings/date_format?2%20January%202006%2015:04", &h.cert)
+	_, body = h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "14 März 2024 11:09") {
+		t.Errorf("entry date isn’t in the chosen language and the profile timezone:\n%s", body)
+	}
+
+	h.get(t, "/settings/language?miniflux", &h.cert)
+	_, body = h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "14 mars 2024 11:09") {
+		t.Errorf("entry date isn’t back to the language of the Miniflux profile:\n%s", body)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	h := newHarness(t)
+
+	_, body := h.get(t, "/", &h.cert)
+	if !strings.Contains(body, "=> /entry All Unread") {
+		t.Errorf("home isn’t in the language of the Miniflux profile:\n%s", body)
+	}
+
+	h.get(t, "/settings/language?fr", &h.cert)
+	_, body = h.get(t, "/", &h.cert)
+	if !strings.Contains(body, "=> /entry Tous les non lus") {
+		t.Errorf("home isn’t in the chosen language:\n%s", body)
+	}
+	resp, _ := h.get(t, "/mark_as?_status=read", &h.cert)
+	if resp.Status != gemini.StatusBadRequest || resp.Meta != "identifiant manquant" {
+		t.Errorf("response = %d %q, want a translated error", resp.Status, resp.Meta)
+	}
+	resp, _ = h.get(t, "/settings/page_size", &h.cert)
+	if resp.Status != gemini.StatusInput || resp.Meta != "Articles par page (1 à 100)" {
+		t.Errorf("response = %d %q, want a translated prompt", resp.Status, resp.Meta)
+	}
+}
+
+func TestAutoMarkReadOpen(t *testing.T) {
+	h := newHarness(t)
+
+	h.get(t, "/settings/auto_mark_read?open", &h.cert)
+	_, body := h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "⨯ Mark unread") {
+		t.Errorf("opened entry isn’t shown as read:\n%s", body)
+	}
+	if !strings.Contains(body, "=> /entry?offset=0 » Next") {
+		t.Errorf("next entry isn’t at the offset of the entry that left the unread list:\n%s", body)
+	}
+	if status := h.miniflux.entries[0].Status; status != minifluxClient.EntryStatusRead {
+		t.Errorf("entry status = %q, want read", status)
+	}
+}
+
+func TestAutoMarkReadOpenPermalink(t *testing.T) {
+	h := newHarness(t)
+
+	h.get(t, "/settings/auto_mark_read?open", &h.cert)
+	_, body := h.get(t, "/feed.gmi", &h.cert)
+	if !strings.Contains(body, "=> /entry?entryID=101 ") {
+		t.Fatalf("feed doesn’t link to the entry:\n%s", body)
+	}
+	_, body = h.get(t, "/entry?entryID=101", &h.cert)
+	if !strings.Contains(body, "⨯ Mark unread") {
+		t.Errorf("entry opened from the feed isn’t shown as read:\n%s", body)
+	}
+	if status := h.miniflux.entries[1].Status; status != minifluxClient.EntryStatusRead {
+		t.Errorf("entry status = %q, want read", status)
+	}
+
+	// Fetching the full article isn’t opening the entry
+	h.get(t, "/entry?entryID=100&full=true", &h.cert)
+	if status := h.miniflux.entries[0].Status; status != minifluxClient.EntryStatusUnread {
+		t.Errorf("entry status = %q after fetching its full article, want unread", status)
+	}
+}
+
+func TestAutoMarkReadNext(t *testing.T) {
+	h := newHarness(t)
+
+	h.get(t, "/settings/auto_mark_read?next", &h.cert)
+	_, body := h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "=> /read_next?_id=100&offset=0 » Next") {
+		t.Fatalf("next doesn’t mark the entry as read:\n%s", body)
+	}
+	if status := h.miniflux.entries[0].Status; status != minifluxClient.EntryStatusUnread {
+		t.Errorf("entry status = %q before following next, want unread", status)
+	}
+
+	resp, _ := h.get(t, "/read_next?_id=100&offset=0", &h.cert)
+	if resp.Status != gemini.StatusRedirect || resp.Meta != "/entry?offset=0" {
+		t.Fatalf("response = %d %q, want a redirect to the next entry", resp.Status, resp.Meta)
+	}
+	if status := h.miniflux.entries[0].Status; status != minifluxClient.EntryStatusRead {
+		t.Errorf("entry status = %q, want read", status)
+	}
+	_, body = h.get(t, "/entry?offset=0", &h.cert)
+	if !strings.Contains(body, "# Breaking news") {
+		t.Errorf("next entry isn’t the following unread one:\n%s", body)
+	}
+}
+
+func TestInvalidValueTranslated(t *testing.T) {
+	h := newHarness(t)
+	h.get(t, "/settings/language?fr", &h.cert)
+
+	for path, want := range map[string]string{
+		"/settings/page_size?0":           "le nombre d’articles par page doit être entre 1 et",
+		"/conversion/feed/10/links?bogus": "une de ces valeurs attendue : ",
+		"/conversion/heading_offset?9":    "le décalage des titres doit être entre 0 et",
+	} {
+		resp, _ := h.get(t, path, &h.cert)
+		if resp.Status != gemini.StatusBadRequest || !strings.HasPrefix(resp.Meta, want) {
+			t.Errorf("%s: response = %d %q, want %d %q…", path, resp.Status, resp.Meta, gemini.StatusBadRequest, want)
+		}
+	}
+}
+
+func TestConversion(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.get(t, "/conversion/links", &h.cert)
+	if resp.Status != gemini.StatusInput {
+		t.Fatalf("status = %d, want a prompt", resp.Status)
+	}
+	resp, _ = h.get(t, "/conversion/feed/10/links?bogus", &h.cert)
+	if resp.Status != gemini.StatusBadRequest {
+		t.Errorf("status = %d for invalid links, want %d", resp.Status, gemini.StatusBadRequest)
+	}
+	resp, _ = h.get(t, "/conversion/unknown?1", &h.cert)
+	if resp.Status != gemini.StatusNotFound {
+		t.Errorf("status = %d for an unknown option, want %d", resp.Status, gemini.StatusNotFound)
+	}
+
+	resp, _ = h.get(t, "/conversion/feed/10/links?none", &h.cert)
+	if resp.Status != gemini.StatusRedirect || resp.Meta != "/conversion/feed/10/" {
+		t.Fatalf("response = %d %q, want a redirect to the options of the feed", resp.Status, resp.Meta)
+	}
+	_, body := h.get(t, "/conversion/feed/10/", &h.cert)
+	if !strings.Contains(body, "A blog") || !strings.Contains(body, "=> /conversion/feed/10/links?none ●") {
+		t.Errorf("options of the feed don’t show its override:\n%s", body)
+	}
+	_, body = h.get(t, "/entry", &h.cert)
+	if strings.Contains(body, "=> https://example.com") {
+		t.Errorf("entry of the feed doesn’t hide links:\n%s", body)
+	}
+
+	h.get(t, "/conversion/feed/10/links?default", &h.cert)
+	_, body = h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "=> https://example.com") {
+		t.Errorf("entry of the feed still uses the removed override:\n%s", body)
+	}
+}
+
+func TestEntryPages(t *testing.T) {
+	h := newHarness(t)
+	h.miniflux.mu.Lock()
+	paragraph := "<p>" + strings.Repeat("All work and no play makes Jack a dull boy. ", 20) + "</p>"
+	h.miniflux.entries[0].Content = "<h2>Morning</h2>" + strings.Repeat(paragraph, 3) + "<h2>Evening</h2>" + paragraph
+	h.miniflux.mu.Unlock()
+
+	resp, _ := h.get(t, "/settings/page_length?1", &h.cert)
+	if resp.Status != gemini.StatusBadRequest {
+		t.Errorf("status = %d for a too short page length, want %d", resp.Status, gemini.StatusBadRequest)
+	}
+	h.get(t, "/settings/page_length?2", &h.cert)
+	h.get(t, "/settings/auto_mark_read?open", &h.cert)
+
+	_, body := h.get(t, "/entry", &h.cert)
+	for _, want := range []string{
+		"Page 1 of 2",
+		"=> /entry?entryID=100&page=2 Evening",
+		"=> /entry?entryID=100&page=2 → Continue reading",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("first page doesn’t contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "## Evening") {
+		t.Errorf("first page contains the second one:\n%s", body)
+	}
+
+	// The entry was marked as read and left the unread list
+	_, body = h.get(t, "/entry?entryID=100&page=2", &h.cert)
+	for _, want := range []string{"# First post", "Page 2 of 2", "## Evening", "=> /entry?offset=0 » Next"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("second page doesn’t contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestFetchContent(t *testing.T) {
+	h := newHarness(t)
+
+	_, body := h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "=> /entry?entryID=100&full=true 📰 Fetch full article") {
+		t.Fatalf("entry doesn’t link to its full article:\n%s", body)
+	}
+	_, body = h.get(t, "/entry?entryID=100&full=true", &h.cert)
+	if !strings.Contains(body, "The full article") || strings.Contains(body, "Fetch full article") {
+		t.Errorf("entry doesn’t show the full article:\n%s", body)
+	}
+	if h.miniflux.fetches != 1 {
+		t.Errorf("fetches = %d, want 1", h.miniflux.fetches)
+	}
+
+	h.get(t, "/conversion/feed/10/full_content?true", &h.cert)
+	_, body = h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "The full article") {
+		t.Errorf("entry of the feed doesn’t show the full article automatically:\n%s", body)
+	}
+	_, body = h.get(t, "/entry?offset=1", &h.cert)
+	if !strings.Contains(body, "Something happened") {
+		t.Errorf("entry of another feed doesn’t show the content of its feed:\n%s", body)
+	}
+}
+
+func TestMedia(t *testing.T) {
+	h := newHarness(t)
+
+	_, body := h.get(t, "/entry?entryID=102", &h.cert)
+	for _, want := range []string{
+		"=> https://blog.example/old.mp3 🎧 old.mp3 (audio/mpeg, 1.5 MB)",
+		"=> /media?feedID=10 🎧 Media of this feed",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("entry doesn’t contain %q:\n%s", want, body)
+		}
+	}
+
+	resp, body := h.get(t, "/media?feedID=10", &h.cert)
+	if resp.Status != gemini.StatusSuccess {
+		t.Fatalf("status = %d %q, want success", resp.Status, resp.Meta)
+	}
+	if !strings.Contains(body, "## Old post") || strings.Contains(body, "First post") {
+		t.Errorf("media don’t list only the entry with enclosures:\n%s", body)
+	}
+	resp, _ = h.get(t, "/media?feedID=abc", &h.cert)
+	if resp.Status != gemini.StatusBadRequest {
+		t.Errorf("status = %d for an invalid feed, want %d", resp.Status, gemini.StatusBadRequest)
+	}
+}
+
+func TestMediaProxy(t *testing.T) {
+	h := newHarness(t)
+
+	resp, body := h.get(t, h.proxy.URL(h.instance+"/proxy/image.png"), &h.cert)
+	if resp.Status != gemini.StatusSuccess || resp.Meta != "image/png" || body != "PNG" {
+		t.Errorf("response = %d %q %q, want the image", resp.Status, resp.Meta, body)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		status gemini.Status
+	}{
+		{h.proxy.URL(h.instance + "/proxy/large.png"), gemini.StatusPermanentFailure},
+		{h.proxy.URL(h.instance + "/proxy/page.html"), gemini.StatusPermanentFailure},
+		{"/proxy/forged?" + gemini.QueryEscape(h.instance+"/proxy/image.png"), gemini.StatusBadRequest},
+	} {
+		resp, _ := h.get(t, tt.path, &h.cert)
+		if resp.Status != tt.status {
+			t.Errorf("%s: status = %d %q, want %d", tt.path, resp.Status, resp.Meta, tt.status)
+		}
+	}
+
+	// Only the Miniflux instance can be on a private address
+	other := httptest.NewServer(h.miniflux)
+	t.Cleanup(other.Close)
+	resp, _ = h.get(t, h.proxy.URL(other.URL+"/proxy/image.png"), &h.cert)
+	if resp.Status != gemini.StatusProxyError {
+		t.Errorf("status = %d %q for a private address, want %d", resp.Status, resp.Meta, gemini.StatusProxyError)
+	}
+
+	// Nor through redirects of the instance
+	redirect := h.instance + "/proxy/redirect?to="
+	resp, body = h.get(t, h.proxy.URL(redirect+url.QueryEscape(h.instance+"/proxy/image.png")), &h.cert)
+	if resp.Status != gemini.StatusSuccess || body != "PNG" {
+		t.Errorf("response = %d %q %q for a redirect to the instance, want the image", resp.Status, resp.Meta, body)
+	}
+	resp, _ = h.get(t, h.proxy.URL(redirect+url.QueryEscape(other.URL+"/proxy/image.png")), &h.cert)
+	if resp.Status != gemini.StatusProxyError {
+		t.Errorf("status = %d %q for a redirect to a private address, want %d", resp.Status, resp.Meta, gemini.StatusProxyError)
+	}
+}
+
+func TestReader(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.get(t, "/read", &h.cert)
+	if resp.Status != gemini.StatusInput {
+		t.Fatalf("status = %d, want a prompt", resp.Status)
+	}
+
+	page := h.instance + "/web/article.html"
+	resp, body := h.get(t, "/read?"+gemini.QueryEscape(page), &h.cert)
+	if resp.Status != gemini.StatusSuccess {
+		t.Fatalf("status = %d %q, want the page", resp.Status, resp.Meta)
+	}
+	for _, want := range []string{
+		"# An été article",
+		"Summer",
+		"=> " + h.instance + "/web/other.html",
+		"=> /subscribe?" + gemini.QueryEscape(page),
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page doesn’t contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Menu") || strings.Contains(body, "Copyright") {
+		t.Errorf("page contains its navigation:\n%s", body)
+	}
+
+	for _, tt := range []struct {
+		path   string
+		status gemini.Status
+	}{
+		{"/read?" + gemini.QueryEscape("ftp://example.com/file"), gemini.StatusBadRequest},
+		{"/read?" + gemini.QueryEscape(h.instance+"/proxy/image.png"), gemini.StatusPermanentFailure},
+	} {
+		resp, _ := h.get(t, tt.path, &h.cert)
+		if resp.Status != tt.status {
+			t.Errorf("%s: status = %d %q, want %d", tt.path, resp.Status, resp.Meta, tt.status)
+		}
+	}
+
+	// Only the Miniflux instance can be on a private address
+	other := httptest.NewServer(h.miniflux)
+	t.Cleanup(other.Close)
+	resp, _ = h.get(t, "/read?"+gemini.QueryEscape(other.URL+"/web/article.html"), &h.cert)
+	if resp.Status != gemini.StatusProxyError {
+		t.Errorf("status = %d %q for a private address, want %d", resp.Status, resp.Meta, gemini.StatusProxyError)
+	}
+}
+
+func TestReaderLinks(t *testing.T) {
+	h := newHarness(t)
+
+	h.get(t, "/conversion/web_links?reader", &h.cert)
+	_, body := h.get(t, "/entry", &h.cert)
+	if !strings.Contains(body, "=> /read?"+gemini.QueryEscape("https://example.com")) {
+		t.Errorf("entry links aren’t read through the reader:\n%s", body)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	h := newHarness(t)
+
+	feedURL := h.instance + "/web/feed.xml"
+	_, body := h.get(t, "/subscribe?"+gemini.QueryEscape(h.instance+"/web/article.html"), &h.cert)
+	link := "=> /subscribe/2?" + gemini.QueryEscape(feedURL)
+	if !strings.Contains(body, "## Web feed") || !strings.Contains(body, link) {
+		t.Fatalf("feeds of the page aren’t listed:\n%s", body)
+	}
+
+	_, body = h.get(t, "/subscribe?"+gemini.QueryEscape(h.instance+"/proxy/page.html"), &h.cert)
+	if !strings.Contains(body, "No feed found on this page") {
+		t.Errorf("page without feeds:\n%s", body)
+	}
+
+	resp, _ := h.get(t, "/subscribe/2?"+gemini.QueryEscape(feedURL), &h.cert)
+	if resp.Status != gemini.StatusRedirect || resp.Meta != "/entry?feedID=12" {
+		t.Errorf("response = %d %q, want a redirect to the new feed", resp.Status, resp.Meta)
+	}
+	if feed := h.miniflux.feeds[len(h.miniflux.feeds)-1]; feed.FeedURL != feedURL || feed.Category.ID != 2 {
+		t.Errorf("created feed = %q in category %d", feed.FeedURL, feed.Category.ID)
+	}
+}
+
+func TestEntryFeed(t *testing.T) {
+	h := newHarness(t)
+
+	resp, body := h.get(t, "/feed.gmi", &h.cert)
+	if resp.Status != gemini.StatusSuccess {
+		t.Fatalf("status = %d %q, want the feed", resp.Status, resp.Meta)
+	}
+	for _, want := range []string{"# Unread entries", "=> /entry?entryID=100 2024-03-14 First post", "=> /entry?entryID=101 2024-03-14 Breaking news"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed doesn’t contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Old post") {
+		t.Errorf("feed lists a read entry:\n%s", body)
+	}
+
+	_, body = h.get(t, "/feed.gmi?feedID=10&statuses=unread&statuses=read", &h.cert)
+	if !strings.Contains(body, "# Unread entries of A blog") || !strings.Contains(body, "Old post") || strings.Contains(body, "Breaking news") {
+		t.Errorf("feed doesn’t follow the filter:\n%s", body)
+	}
+
+	resp, body = h.get(t, "/feed.atom?starred=true", &h.cert)
+	if resp.Status != gemini.StatusSuccess || resp.Meta != "application/atom+xml" {
+		t.Fatalf("response = %d %q, want an Atom feed", resp.Status, resp.Meta)
+	}
+	if !strings.Contains(body, "<title>Starred entries</title>") || !strings.Contains(body, "/entry?entryID=101</id>") || strings.Contains(body, "entryID=100") {
+		t.Errorf("Atom feed doesn’t list the starred entry:\n%s", body)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := newHarness(t)
+
+	resp, body := h.get(t, "/history", &h.cert)
+	if resp.Status != gemini.StatusSuccess {
+		t.Fatalf("status = %d %q, want the history", resp.Status, resp.Meta)
+	}
+	if !strings.Contains(body, "## Old post") || !strings.Contains(body, "=> /entry?entryID=102") || strings.Contains(body, "First post") {
+		t.Errorf("history doesn’t list the read entry only:\n%s", body)
+	}
+
+	// A page at a time
+	h.get(t, "/settings/page_size?1", &h.cert)
+	h.get(t, "/mark_as?_id=100&_status=read", &h.cert)
+	_, body = h.get(t, "/history", &h.cert)
+	if !strings.Contains(body, "=> /history?offset=1 → Older entries") {
+		t.Errorf("history doesn’t link to the next page:\n%s", body)
+	}
+	_, body = h.get(t, "/history?offset=1", &h.cert)
+	if !strings.Contains(body, "=> /history?offset=0 ← Newer entries") || strings.Contains(body, "Older entries") {
+		t.Errorf("last page of the history:\n%s", body)
+	}
+
+	resp, _ = h.get(t, "/mark_as?_id=102&_status=unread&_from=history&offset=1", &h.cert)
+	if resp.Status != gemini.StatusRedirect || resp.Meta != "/history?offset=1" {
+		t.Errorf("response = %d %q, want a redirect to the history", resp.Status, resp.Meta)
+	}
+	if status := h.miniflux.entries[2].Status; status != minifluxClient.EntryStatusUnread {
+		t.Errorf("entry status = %q, want unread", status)
+	}
+}
+
+func TestSavedViews(t *testing.T) {
+	h := newHarness(t)
+
+	_, body := h.get(t, "/?feedID=10&offset=3", &h.cert)
+	if !strings.Contains(body, "=> /views/new/feedID=10 💾 Save this filter") {
+		t.Fatalf("home doesn’t offer to save the filter without its offset:\n%s", body)
+	}
+	resp, _ := h.get(t, "/views/new/feedID=10", &h.cert)
+	if resp.Status != gemini.StatusInput {
+		t.Fatalf("status = %d, want a prompt for the name", resp.Status)
+	}
+	resp, _ = h.get(t, "/views/new/feedID=10?%20", &h.cert)
+	if resp.Status != gemini.StatusBadRequest {
+		t.Errorf("status = %d for a blank name, want %d", resp.Status, gemini.StatusBadRequest)
+	}
+	resp, _ = h.get(t, "/views/new/feedID=10?My%20blog", &h.cert)
+	if resp.Status != gemini.StatusRedirect || resp.Meta != "/views" {
+		t.Fatalf("response = %d %q, want a redirect to the views", resp.Status, resp.Meta)
+	}
+
+	_, body = h.get(t, "/", &h.cert)
+	if !strings.Contains(body, "=> /entry?feedID=10 My blog (1)") {
+		t.Errorf("home doesn’t list the view with its unread count:\n%s", body)
+	}
+
+	h.get(t, "/views/1/name?Blog", &h.cert)
+	h.get(t, "/views/1/filter?starred=true&offset=2", &h.cert)
+	_, body = h.get(t, "/views", &h.cert)
+	if !strings.Contains(body, "## Blog") || !strings.Contains(body, "=> /entry?starred=true 📖 Entries") {
+		t.Errorf("views don’t show the edited view:\n%s", body)
+	}
+
+	resp, _ = h.get(t, "/views/2/name?Other", &h.cert)
+	if resp.Status != gemini.StatusNotFound {
+		t.Errorf("status = %d for an unknown view, want %d", resp.Status, gemini.StatusNotFound)
+	}
+	h.get(t, "/views/1/delete?no", &h.cert)
+	_, body = h.get(t, "/views", &h.cert)
+	if !strings.Contains(body, "## Blog") {
+		t.Errorf("view deleted without confirmation:\n%s", body)
+	}
+	h.get(t, "/views/1/delete?yes", &h.cert)
+	_, body = h.get(t, "/", &h.cert)
+	if strings.Contains(body, "Saved views") {
+		t.Errorf("home still lists the deleted view:\n%s", body)
+	}
+}
+
+func TestSavedViewCounts(t *testing.T) {
+	h := newHarness(t)
+	for _, view := range []string{"feedID=10?Blog", "categoryID=2?Misc", "starred=true?Starred"} {
+		if resp, _ := h.get(t, "/views/new/"+view, &h.cert); resp.Status != gemini.StatusRedirect {
+			t.Fatalf("status = %d saving %s, want a redirect", resp.Status, view)
+		}
+	}
+	h.miniflux.mu.Lock()
+	h.miniflux.listings = 0
+	h.miniflux.mu.Unlock()
+
+	_, body := h.get(t, "/", &h.cert)
+	for _, want := range []string{
+		"=> /entry?feedID=10 Blog (1)",
+		"=> /entry?categoryID=2 Misc (1)",
+		"=> /entry?starred=true Starred (1)",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("home doesn’t contain %q:\n%s", want, body)
+		}
+	}
+	h.miniflux.mu.Lock()
+	defer h.miniflux.mu.Unlock()
+	// Views of a feed or a category are counted from the feed counters
+	if h.miniflux.listings != 1 {
+		t.Errorf("listings = %d, want 1 for the starred view", h.miniflux.listings)
+	}
+}
+
+func TestTags(t *testing.T) {
+	h := newHarness(t)
+
+	_, body := h.get(t, "/tags", &h.cert)
+	for _, want := range []string{
+		"=> /entry?tag=Go 🏷 Go (1/2)",
+		"=> /entry?tag=Release 🏷 Release (1/1)",
+		"=> /entry?tag=World 🏷 World (1/1)",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("tags don’t contain %q:\n%s", want, body)
+		}
+	}
+
+	_, body = h.get(t, "/entry?tag=world", &h.cert)
+	if !strings.Contains(body, "# Breaking news") {
+		t.Errorf("entry of the tag isn’t the one carrying it:\n%s", body)
+	}
+	_, body = h.get(t, "/entry?tag=Go", &h.cert)
+	if !strings.Contains(body, "# First post") || !strings.Contains(body, "=> /entry?tag=Release 🏷 Release") {
+		t.Errorf("entry doesn’t link to its tags:\n%s", body)
+	}
+	_, body = h.get(t, "/entry?tag=go&statuses=unread&statuses=read&offset=1", &h.cert)
+	if !strings.Contains(body, "# Old post") {
+		t.Errorf("second entry of the tag isn’t the read one:\n%s", body)
+	}
+	resp, _ := h.get(t, "/entry?tag=go&offset=1", &h.cert)
+	if resp.Status != gemini.StatusTemporaryFailure {
+		t.Errorf("status = %d past the unread entries of the tag, want %d", resp.Status, gemini.StatusTemporaryFailure)
+	}
+}
+
+func TestTagScanStops(t *testing.T) {
+	h := newHarness(t)
+	h.miniflux.mu.Lock()
+	// Older entries without the tag, over several pages
+	for i := range 3 * tagPageSize {
+		entry := *h.miniflux.entries[2]
+		entry.ID = int64(1000 + i)
+		entry.Status = minifluxClient.EntryStatusUnread
+		entry.Tags = nil
+		h.miniflux.entries = append(h.miniflux.entries, &entry)
+	}
+	h.miniflux.listings = 0
+	h.miniflux.mu.Unlock()
+
+	_, body := h.get(t, "/entry?tag=Go", &h.cert)
+	if !strings.Contains(body, "# First post") {
+		t.Errorf("entry isn’t the first one with the tag:\n%s", body)
+	}
+	h.miniflux.mu.Lock()
+	defer h.miniflux.mu.Unlock()
+	if h.miniflux.listings != 1 {
+		t.Errorf("listings = %d for the first entry of a tag, want 1", h.miniflux.listings)
+	}
+}
+
+func TestTagScanCut(t *testing.T) {
+	h := newHarness(t)
+	h.miniflux.mu.Lock()
+	for i := range maxTagScan {
+		entry := *h.miniflux.entries[2]
+		entry.ID = int64(1000 + i)
+		entry.Status = minifluxClient.EntryStatusUnread
+		entry.Tags = nil
+		h.miniflux.entries = append(h.miniflux.entries, &entry)
+	}
+	h.miniflux.mu.Unlock()
+	view := &gemtext.SavedView{Name: "Go", Filter: url.Values{"tag": {"Go"}}}
+	if err := h.db.SaveView(fingerprint(h.cert.Leaf), view); err != nil {
+		t.Fatalf("SaveView: %v", err)
+	}
+
+	resp, _ := h.get(t, "/entry?tag=Nowhere", &h.cert)
+	if resp.Status != gemini.StatusTemporaryFailure || !strings.Contains(resp.Meta, fmt.Sprintf("%d most recent", maxTagScan)) {
+		t.Errorf("response = %d %q for a tag past the scan, want the scan limit", resp.Status, resp.Meta)
+	}
+	_, body := h.get(t, "/feed.gmi?tag=Nowhere", &h.cert)
+	if !strings.Contains(body, fmt.Sprintf("Only the %d most recent entries", maxTagScan)) {
+		t.Errorf("feed doesn’t tell the scan was cut:\n%s", body)
+	}
+	_, body = h.get(t, "/", &h.cert)
+	if !strings.Contains(body, "=> /entry?tag=Go Go (1+)") {
+		t.Errorf("count of the view doesn’t tell there may be more:\n%s", body)
+	}
+}
+
+// Linked by the home page, but not routed
+var unroutedLinks = []string{"/refresh_all"}
+
+// routed tells whether a pattern of newMux matches path, other than the one
+// of the home page, which matches all paths
+func routed(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if path == pattern || pattern != "/" && strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGoldenLinksRouted(t *testing.T) {
+	_, patterns := newMux(nil, &mediaProxy{}, fetcher{})
+	goldens, err := filepath.Glob(filepath.Join("gemtext", "testdata", "*.gmi"))
+	if err != nil || len(goldens) == 0 {
+		t.Fatalf("no golden file: %v", err)
+	}
+
+	for _, golden := range goldens {
+		text, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("reading %s: %v", golden, err)
+		}
+		preformatted := false
+		for _, line := range strings.Split(string(text), "\n") {
+			if strings.HasPrefix(line, "```") {
+				preformatted = !preformatted
+			}
+			if preformatted || !strings.HasPrefix(line, "=>") {
+				continue
+			}
+			fields := strings.Fields(strings.TrimPrefix(line, "=>"))
+			if len(fields) == 0 {
+				continue
+			}
+			u, err := url.Parse(fields[0])
+			if err != nil || u.IsAbs() || !strings.HasPrefix(u.Path, "/") || slices.Contains(unroutedLinks, u.Path) {
+				continue
+			}
+			if !routed(patterns, u.Path) {
+				t.Errorf("%s: %q links to a path no route serves", filepath.Base(golden), line)
+			}
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+	"git.sr.ht/~adnano/go-gemini/certificate"
+	minifluxClient "miniflux.app/client"
+)
+
+const fakeToken = "fake-token"
+
+// fakeMiniflux implements the parts of the Miniflux API we use, on top of
+// in-memory data
+type fakeMiniflux struct {
+	mu         sync.Mutex
+	me         minifluxClient.User
+	categories minifluxClient.Categories
+	feeds      minifluxClient.Feeds
+	entries    minifluxClient.Entries
+	refreshes  int
+	fetches    int
+	// Requests listing entries
+	listings int
+	// Entries sent to third-party integrations
+	saved []int64
+	// Whether no integration is enabled, so that entries can’t be saved
+	noIntegration bool
+	// Answered to all the API requests when not 0, like 429 when rate
+	// limiting
+	status int
+}
+
+func newFakeMiniflux() *fakeMiniflux {
+	tech := &minifluxClient.Category{ID: 1, Title: "Tech"}
+	misc := &minifluxClient.Category{ID: 2, Title: "Misc"}
+	blog := &minifluxClient.Feed{ID: 10, Title: "A blog", Category: tech}
+	news := &minifluxClient.Feed{ID: 11, Title: "Some news", Category: misc}
+	date := time.Date(2024, time.March, 14, 15, 9, 26, 0, time.UTC)
+
+	return &fakeMiniflux{
+		me:         minifluxClient.User{ID: 1, Username: "reader", Timezone: "America/New_York", Language: "en_US"},
+		categories: minifluxClient.Categories{tech, misc},
+		feeds:      minifluxClient.Feeds{blog, news},
+		entries: minifluxClient.Entries{
+			{
+				ID: 100, FeedID: blog.ID, Feed: blog, Status: minifluxClient.EntryStatusUnread,
+				Title: "First post", URL: "https://blog.example/first", Date: date,
+				Content: "<p>Hello <a href=\"https://example.com\">world</a></p>", Author: "Alice", ReadingTime: 1, Tags: []string{"Go", "Release"},
+			},
+			{
+				ID: 101, FeedID: news.ID, Feed: news, Status: minifluxClient.EntryStatusUnread,
+				Title: "Breaking news", URL: "https://news.example/breaking", Date: date.Add(-time.Hour),
+				Content: "<p>Something happened</p>", Starred: true, ReadingTime: 3, Tags: []string{"World"},
+			},
+			{
+				ID: 102, FeedID: blog.ID, Feed: blog, Status: minifluxClient.EntryStatusRead,
+				Title: "Old post", URL: "https://blog.example/old", Date: date.Add(-24 * time.Hour),
+				Content: "<p>Already read</p>", ReadingTime: 2, Tags: []string{"go"},
+				Enclosures: minifluxClient.Enclosures{
+					{ID: 1, EntryID: 102, URL: "https://blog.example/old.mp3", MimeType: "audio/mpeg", Size: 1_500_000},
+				},
+			},
+		},
+	}
+}
+
+func (f *fakeMiniflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Like the media proxy of Miniflux, it doesn’t need the token
+	switch r.URL.Path {
+	case "/proxy/image.png":
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("PNG"))
+		return
+	case "/proxy/large.png":
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 2000))
+		return
+	case "/proxy/page.html":
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p>Page</p>"))
+		return
+	case "/proxy/redirect":
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		return
+	// A web page entries link to, for the reader
+	case "/web/article.html":
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.Write([]byte("<html><head><title>An \xe9t\xe9 article</title></head><body>" +
+			"<nav><a href=\"/\">Menu</a></nav>" +
+			"<article><h1>Summer</h1><p>Long <a href=\"other.html\">days</a></p></article>" +
+			"<footer>Copyright</footer></body></html>"))
+		return
+	}
+
+	if r.Header.Get("X-Auth-Token") != fakeToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/me":
+		writeJSON(w, f.me)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/categories":
+		writeJSON(w, f.categories)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/feeds":
+		writeJSON(w, f.feeds)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/feeds/") && !strings.HasSuffix(r.URL.Path, "counters"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/v1/feeds/"), 10, 64)
+		i := slices.IndexFunc(f.feeds, func(feed *minifluxClient.Feed) bool { return feed.ID == id })
+		if i < 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, f.feeds[i])
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/feeds/counters":
+		counters := minifluxClient.FeedCounters{
+			ReadCounters:   make(map[int64]int),
+			UnreadCounters: make(map[int64]int),
+		}
+		for _, entry := range f.entries {
+			if entry.Status == minifluxClient.EntryStatusUnread {
+				counters.UnreadCounters[entry.FeedID]++
+			} else {
+				counters.ReadCounters[entry.FeedID]++
+			}
+		}
+		writeJSON(w, counters)
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/entries":
+		f.listings++
+		writeJSON(w, f.filterEntries(r.URL.Query()))
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/fetch-content"):
+		f.fetches++
+		writeJSON(w, map[string]string{"content": "<p>The full article</p>"})
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/v1/entries/") && strings.HasSuffix(r.URL.Path, "/save"):
+		if f.noIntegration {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error_message": "no third-party integration enabled"})
+			return
+		}
+		id, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/entries/"), "/save"), 10, 64)
+		f.saved = append(f.saved, id)
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/entries/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/v1/entries/"), 10, 64)
+		i := slices.IndexFunc(f.entries, func(entry *minifluxClient.Entry) bool { return entry.ID == id })
+		if i < 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, f.entries[i])
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/entries":
+		var payload struct {
+			EntryIDs []int64 `json:"entry_ids"`
+			Status   string  `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, entry := range f.entries {
+			if slices.Contains(payload.EntryIDs, entry.ID) {
+				entry.Status = payload.Status
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/discover":
+		var payload struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !strings.HasSuffix(payload.URL, "/web/article.html") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, minifluxClient.Subscriptions{{Title: "Web feed", URL: strings.TrimSuffix(payload.URL, "article.html") + "feed.xml", Type: "atom"}})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/feeds":
+		var payload minifluxClient.FeedCreationRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		i := slices.IndexFunc(f.categories, func(category *minifluxClient.Category) bool { return category.ID == payload.CategoryID })
+		if i < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		feed := &minifluxClient.Feed{ID: int64(10 + len(f.feeds)), FeedURL: payload.FeedURL, Title: payload.FeedURL, Category: f.categories[i]}
+		f.feeds = append(f.feeds, feed)
+		writeJSON(w, map[string]int64{"feed_id": feed.ID})
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/feeds/refresh":
+		f.refreshes++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// filterEntries applies the subset of the Miniflux filters we send
+func (f *fakeMiniflux) filterEntries(query map[string][]string) minifluxClient.EntryResultSet {
+	get := func(key string) string {
+		if values := query[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	var matching minifluxClient.Entries
+	for _, entry := range f.entries {
+		if statuses := query["status"]; len(statuses) > 0 && !slices.Contains(statuses, entry.Status) {
+			continue
+		}
+		if starred := get("starred"); (starred == "true" || starred == "1") && !entry.Starred {
+			continue
+		}
+		if feedID := get("feed_id"); feedID != "" && feedID != strconv.FormatInt(entry.FeedID, 10) {
+			continue
+		}
+		if categoryID := get("category_id"); categoryID != "" && categoryID != strconv.FormatInt(entry.Feed.Category.ID, 10) {
+			continue
+		}
+		matching = append(matching, entry)
+	}
+
+	total := len(matching)
+	offset, _ := strconv.Atoi(get("offset"))
+	matching = matching[min(offset, len(matching)):]
+	if limit, _ := strconv.Atoi(get("limit")); limit > 0 {
+		matching = matching[:min(limit, len(matching))]
+	}
+
+	return minifluxClient.EntryResultSet{Total: total, Entries: matching}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// harness runs the Gemini server on a loopback port, backed by a fake
+// Miniflux and a temporary database
+type harness struct {
+	addr     string
+	miniflux *fakeMiniflux
+	instance string
+	db       *SqliteDB
+	proxy    *mediaProxy
+	// Serves the requests, tests can wrap it in other middlewares
+	handler gemini.Handler
+	// Enrolled in the database with the fake Miniflux token
+	cert tls.Certificate
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	miniflux := newFakeMiniflux()
+	minifluxServer := httptest.NewServer(miniflux)
+	t.Cleanup(minifluxServer.Close)
+
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB: %v", err)
+	}
+
+	// Small limits, to test them
+	proxy, err := newMediaProxy(fetcher{maxSize: 1000, types: []string{"image/"}})
+	if err != nil {
+		t.Fatalf("newMediaProxy: %v", err)
+	}
+	mux, _ := newMux(db, proxy, fetcher{maxSize: 1000, types: []string{"text/html"}})
+	handler, err := NewUserMiddleware(db, mux)
+	if err != nil {
+		t.Fatalf("NewUserMiddleware: %v", err)
+	}
+
+	h := &harness{
+		miniflux: miniflux,
+		instance: minifluxServer.URL,
+		db:       db,
+		proxy:    proxy,
+		handler:  handler,
+		cert:     newCertificate(t, "client"),
+	}
+
+	serverCert := newCertificate(t, "localhost")
+	server := &gemini.Server{
+		Handler: gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+			h.handler.ServeGemini(ctx, w, r)
+		}),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 5 * time.Second,
+		GetCertificate: func(string) (*tls.Certificate, error) {
+			return &serverCert, nil
+		},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	listener = tls.NewListener(listener, &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &serverCert, nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go server.Serve(ctx, listener)
+	t.Cleanup(cancel)
+
+	h.addr = listener.Addr().String()
+	h.enroll(t, h.cert, h.instance, fakeToken)
+
+	return h
+}
+
+func newCertificate(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	cert, err := certificate.Create(certificate.CreateOptions{
+		DNSNames: []string{name},
+		Subject:  pkix.Name{CommonName: name},
+		Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("creating certificate %q: %v", name, err)
+	}
+	return cert
+}
+
+// client returns a Miniflux client of the enrolled user, for calls no route
+// makes
+func (h *harness) client() *MinifluxClient {
+	return &MinifluxClient{Client: minifluxClient.New(h.instance, fakeToken)}
+}
+
+// enroll adds the user of the certificate to the database
+func (h *harness) enroll(t *testing.T, cert tls.Certificate, instance, token string) {
+	t.Helper()
+	_, err := h.db.db.Exec(
+		"INSERT INTO Users(certFingerprint, instance, token) VALUES (?, ?, ?)",
+		fingerprint(cert.Leaf), instance, token,
+	)
+	if err != nil {
+		t.Fatalf("enrolling user: %v", err)
+	}
+}
+
+// get requests path with the given client certificate, nil for none, and
+// returns the response with its body read
+func (h *harness) get(t *testing.T, path string, cert *tls.Certificate) (*gemini.Response, string) {
+	t.Helper()
+
+	req, err := gemini.NewRequest("gemini://" + h.addr + path)
+	if err != nil {
+		t.Fatalf("NewRequest %q: %v", path, err)
+	}
+	req.Certificate = cert
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := &gemini.Client{}
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		t.Fatalf("requesting %q: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading body of %q: %v", path, err)
+	}
+	return resp, string(body)
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+)
+
+const minifluxHealthTimeout = 5 * time.Second
+
+// HealthChecker verifies that the server can serve requests
+type HealthChecker struct {
+	db           *SqliteDB
+	certificates *certificate.Store
+	host         string
+	// The certificate is reported unhealthy when it expires sooner than that
+	minValidity time.Duration
+	// Whether to also check that the Miniflux instances of users answer
+	checkMiniflux bool
+}
+
+func NewHealthChecker(db *SqliteDB, certificates *certificate.Store, host string, minValidity time.Duration, checkMiniflux bool) (*HealthChecker, error) {
+	if db == nil || certificates == nil {
+		return nil, fmt.Errorf(
+			"NewHealthChecker: nil values not allowed",
+		)
+	}
+	return &HealthChecker{db, certificates, host, minValidity, checkMiniflux}, nil
+}
+
+// Check returns an error listing every failed check
+func (hc *HealthChecker) Check(ctx context.Context) error {
+	var errs []error
+
+	if err := hc.db.Ping(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("database: %w", err))
+	}
+	if err := hc.checkCertificate(time.Now()); err != nil {
+		errs = append(errs, fmt.Errorf("certificate: %w", err))
+	}
+	if hc.checkMiniflux {
+		if err := hc.checkInstances(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (hc *HealthChecker) checkCertificate(now time.Time) error {
+	cert, ok := hc.certificates.Lookup(hc.host)
+	if !ok || len(cert.Certificate) == 0 {
+		return fmt.Errorf("none loaded for %q", hc.host)
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+	}
+	if leaf.NotAfter.Sub(now) < hc.minValidity {
+		return fmt.Errorf("%q expires on %v", hc.host, leaf.NotAfter)
+	}
+	return nil
+}
+
+func (hc *HealthChecker) checkInstances(ctx context.Context) error {
+	instances, err := hc.db.Instances()
+	if err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+
+	client := http.Client{Timeout: minifluxHealthTimeout}
+	var errs []error
+	for _, instance := range instances {
+		url := strings.TrimSuffix(instance, "/") + "/healthcheck"
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("miniflux %q: %w", instance, err))
+			continue
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("miniflux %q: %w", instance, err))
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			errs = append(errs, fmt.Errorf("miniflux %q: status %d", instance, resp.StatusCode))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ServeHTTP answers /healthz as soon as the process is up and /readyz when
+// all the checks pass
+func (hc *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		fmt.Fprintln(w, "ok")
+	case "/readyz":
+		if err := hc.Check(r.Context()); err != nil {
+			log.Printf("readiness check failed: %v", err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	default:
+		http.NotFound(w, r)
+	}
+}
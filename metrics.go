@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "miniflux_gemini"
+
+// Metrics groups all the collectors exposed on the metrics endpoint
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	activeRequests     prometheus.Gauge
+	minifluxDuration   *prometheus.HistogramVec
+	minifluxErrors     *prometheus.CounterVec
+	conversionDuration prometheus.Histogram
+
+	mu sync.Mutex
+	// Last request of each user, by certificate fingerprint
+	lastSeen map[string]time.Time
+}
+
+// Users who made a request for that long are counted as active
+const activeUsersWindow = 24 * time.Hour
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Gemini requests served, by route and status.",
+		}, []string{"route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time to serve Gemini requests, by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route"}),
+		activeRequests: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_requests",
+			Help:      "Gemini requests being served.",
+		}),
+		minifluxDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "miniflux_request_duration_seconds",
+			Help:      "Time taken by calls to the Miniflux API, by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		minifluxErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "miniflux_errors_total",
+			Help:      "Failed calls to the Miniflux API, by endpoint.",
+		}, []string{"endpoint"}),
+		conversionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "html_conversion_duration_seconds",
+			Help:      "Time taken to convert entries from HTML to gemtext.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 12),
+		}),
+		lastSeen: make(map[string]time.Time),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.activeRequests,
+		m.minifluxDuration,
+		m.minifluxErrors,
+		m.conversionDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "active_users",
+			Help:      "Users who made a request in the last 24 hours.",
+		}, func() float64 {
+			return float64(m.activeUsers(time.Now()))
+		}),
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// ListenAndServe exposes the metrics over HTTP, on the /metrics path
+func (m *Metrics) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return http.ListenAndServe(addr, mux)
+}
+
+// userSeen records a request of the user with the certificate. Metrics are
+// optional, so it does nothing on a nil Metrics
+func (m *Metrics) userSeen(certFingerprint string, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastSeen[certFingerprint] = now
+}
+
+// activeUsers counts the users seen in the last activeUsersWindow, and forgets
+// the others
+func (m *Metrics) activeUsers(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for certFingerprint, seen := range m.lastSeen {
+		if now.Sub(seen) > activeUsersWindow {
+			delete(m.lastSeen, certFingerprint)
+		}
+	}
+	return len(m.lastSeen)
+}
+
+// ObserveConversion records the time taken by an HTML to gemtext conversion
+func (m *Metrics) ObserveConversion(d time.Duration) {
+	m.conversionDuration.Observe(d.Seconds())
+}
+
+// Numeric IDs in Miniflux API paths, replaced to keep the endpoint label
+// bounded
+var minifluxPathID = regexp.MustCompile(`/[0-9]+(/|$)`)
+
+// minifluxEndpoint returns the label of a call to the Miniflux API
+func minifluxEndpoint(method, path string) string {
+	return method + " " + minifluxPathID.ReplaceAllString(path, "/:id$1")
+}
+
+// observeMiniflux records a call to the Miniflux API. Metrics are optional,
+// so it does nothing on a nil Metrics
+func (m *Metrics) observeMiniflux(endpoint string, d time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+	m.minifluxDuration.WithLabelValues(endpoint).Observe(d.Seconds())
+	if failed {
+		m.minifluxErrors.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// MetricsMiddleware counts requests and measures their latency. Paths that
+// aren’t among the known routes are grouped, to keep the route label bounded
+type MetricsMiddleware struct {
+	metrics *Metrics
+	routes  map[string]bool
+	h       gemini.Handler
+}
+
+func NewMetricsMiddleware(metrics *Metrics, routes []string, h gemini.Handler) (*MetricsMiddleware, error) {
+	if metrics == nil || h == nil {
+		return nil, fmt.Errorf(
+			"NewMetricsMiddleware: nil values not allowed",
+		)
+	}
+	known := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		known[route] = true
+	}
+	return &MetricsMiddleware{metrics, known, h}, nil
+}
+
+// route returns the pattern matching path, like the mux would
+func (mm *MetricsMiddleware) route(path string) string {
+	if mm.routes[path] {
+		return path
+	}
+	route := ""
+	for pattern := range mm.routes {
+		if strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern) && len(pattern) > len(route) {
+			route = pattern
+		}
+	}
+	if route == "" {
+		return "other"
+	}
+	return route
+}
+
+func (mm *MetricsMiddleware) ServeGemini(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	route := mm.route(r.URL.Path)
+
+	mm.metrics.activeRequests.Inc()
+	defer mm.metrics.activeRequests.Dec()
+
+	start := time.Now()
+	sw := &statusResponseWriter{ResponseWriter: w}
+	mm.h.ServeGemini(context.WithValue(ctx, metricsKey, mm.metrics), sw, r)
+
+	mm.metrics.requestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	mm.metrics.requests.WithLabelValues(route, strconv.Itoa(int(sw.Status()))).Inc()
+}
+
+// MetricsFromContext returns the metrics of the server, or nil when they
+// aren’t enabled, which the methods recording them accept
+func MetricsFromContext(ctx context.Context) *Metrics {
+	metrics, _ := ctx.Value(metricsKey).(*Metrics)
+	return metrics
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cj.rs/miniflux-gemini/gemtext"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrape returns the metrics in the text format Prometheus reads
+func scrape(t *testing.T, metrics *Metrics) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	return recorder.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	h := newHarness(t)
+	metrics := NewMetrics()
+	handler, err := NewMetricsMiddleware(metrics, []string{"/", "/entry", "/conversion/"}, h.handler)
+	if err != nil {
+		t.Fatalf("NewMetricsMiddleware: %v", err)
+	}
+	h.handler = handler
+	gemtext.ObserveConversion = metrics.ObserveConversion
+	t.Cleanup(func() { gemtext.ObserveConversion = nil })
+
+	h.get(t, "/entry", &h.cert)
+	h.get(t, "/entry?entryID=100&full=true", &h.cert)
+	h.get(t, "/entry?entryID=999", &h.cert)
+	h.get(t, "/conversion/feed/10/", &h.cert)
+	h.get(t, "/unknown/path", nil)
+
+	body := scrape(t, metrics)
+	for _, want := range []string{
+		`miniflux_gemini_requests_total{route="/entry",status="20"} 2`,
+		`miniflux_gemini_requests_total{route="/conversion/",status="20"} 1`,
+		// Like the mux, / matches all the paths
+		`miniflux_gemini_requests_total{route="/",status="60"} 1`,
+		`miniflux_gemini_miniflux_request_duration_seconds_count{endpoint="GET /v1/entries"} 1`,
+		// Calls the client library doesn’t support are measured too
+		`miniflux_gemini_miniflux_request_duration_seconds_count{endpoint="GET /v1/entries/:id/fetch-content"} 1`,
+		`miniflux_gemini_miniflux_errors_total{endpoint="GET /v1/entries/:id"} 1`,
+		`miniflux_gemini_html_conversion_duration_seconds_count 2`,
+		`miniflux_gemini_active_users 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics don’t contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestActiveUsers(t *testing.T) {
+	metrics := NewMetrics()
+	now := time.Now()
+	metrics.userSeen("old", now.Add(-activeUsersWindow-time.Minute))
+	metrics.userSeen("recent", now.Add(-time.Hour))
+	metrics.userSeen("recent", now)
+	metrics.userSeen("other", now)
+
+	if active := metrics.activeUsers(now); active != 2 {
+		t.Errorf("active users = %d, want 2", active)
+	}
+	if _, ok := metrics.lastSeen["old"]; ok {
+		t.Errorf("inactive user isn’t forgotten")
+	}
+	// Without metrics enabled
+	var none *Metrics
+	none.userSeen("user", now)
+	none.observeMiniflux("GET /v1/me", time.Second, true)
+}
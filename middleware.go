@@ -23,7 +23,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"log"
+	"time"
 
+	"cj.rs/miniflux-gemini/gemtext"
 	"git.sr.ht/~adnano/go-gemini"
 )
 
@@ -34,7 +36,29 @@ func fingerprint(cert *x509.Certificate) string {
 }
 
 // To find various values in context
-const userKey = iota
+const (
+	userKey = iota
+	metricsKey
+	lookupKey
+)
+
+// userLookup is the result of looking up the user of a certificate
+type userLookup struct {
+	fingerprint string
+	user        User
+	err         error
+}
+
+// lookupUser returns the user of the certificate fingerprint, looked up once
+// per request as the rate limiter needs it before UserMiddleware, with the
+// context keeping it
+func lookupUser(ctx context.Context, db *SqliteDB, fingerprint string) (context.Context, User, error) {
+	if found, ok := ctx.Value(lookupKey).(*userLookup); ok && found.fingerprint == fingerprint {
+		return ctx, found.user, found.err
+	}
+	user, err := db.GetUser(fingerprint)
+	return context.WithValue(ctx, lookupKey, &userLookup{fingerprint, user, err}), user, err
+}
 
 // UserMiddleware adds the user to context, found by its TLS certificate
 type UserMiddleware struct {
@@ -54,26 +78,49 @@ func NewUserMiddleware(db *SqliteDB, h gemini.Handler) (*UserMiddleware, error)
 func (um *UserMiddleware) ServeGemini(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
 	tls := r.TLS()
 	if len(tls.PeerCertificates) == 0 {
-		w.WriteHeader(gemini.StatusCertificateRequired, "Certificate required, but none provided")
+		w.WriteHeader(gemini.StatusCertificateRequired, translate(ctx, "Certificate required, but none provided"))
 		return
 	}
 	fingerprint := fingerprint(tls.PeerCertificates[0])
 
-	user, err := um.db.GetUser(fingerprint)
+	ctx, user, err := lookupUser(ctx, um.db, fingerprint)
 	if err == ErrUserNotFound {
 		w.WriteHeader(gemini.StatusCertificateNotAuthorized,
-			fmt.Sprintf(
+			translate(ctx,
 				"Unknown certificate, ask your admin to add yours: %q",
 				fingerprint,
 			))
 		return
 	}
 	if err != nil {
-		w.WriteHeader(gemini.StatusPermanentFailure, "Internal Error")
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Internal Error"))
 		log.Printf("error getting user in db: %v", err)
 		return
 	}
 
+	user.settings, err = um.db.GetSettings(fingerprint)
+	if err != nil {
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Internal Error"))
+		log.Printf("error getting user settings in db: %v", err)
+		return
+	}
+	if metrics := MetricsFromContext(ctx); metrics != nil {
+		metrics.userSeen(fingerprint, time.Now())
+	}
+
+	user.conversions, err = um.db.GetConversions(fingerprint)
+	if err != nil {
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Internal Error"))
+		log.Printf("error getting user conversion options in db: %v", err)
+		return
+	}
+	user.settings.Conversion, err = gemtext.DefaultConversion.With(user.conversions[0])
+	if err != nil {
+		// Options are validated when saved, but accepted values may
+		// change between versions
+		log.Printf("error applying user conversion options: %v", err)
+	}
+
 	ctx2 := context.WithValue(ctx, userKey, &user)
 	um.h.ServeGemini(ctx2, w, r)
 }
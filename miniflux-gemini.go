@@ -22,8 +22,12 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"slices"
 	"time"
 
+	"cj.rs/miniflux-gemini/gemtext"
 	"git.sr.ht/~adnano/go-gemini"
 	"git.sr.ht/~adnano/go-gemini/certificate"
 )
@@ -32,32 +36,229 @@ const defaultHost = "devd.io"
 
 var hostFlag = flag.String("host", defaultHost, "hostname to generate a TLS certificate for")
 
-func Run() error {
-	db, err := NewDB("miniflux-gemini.db")
+var (
+	certRateFlag      = flag.Float64("cert-rate", 2, "requests per second allowed for the certificate of each user")
+	certBurstFlag     = flag.Int("cert-burst", 20, "requests the certificate of a user can make in a burst")
+	ipRateFlag        = flag.Float64("ip-rate", 0.5, "requests per second allowed for each IP, for clients without the certificate of a user")
+	ipBurstFlag       = flag.Int("ip-burst", 5, "requests an IP can make in a burst, for clients without the certificate of a user")
+	maxConcurrentFlag = flag.Int("max-concurrent", 32, "maximum number of requests served at the same time")
+)
+
+var languageFlag = flag.String("language", "en", "language of the interface for users who didn’t choose one, here or in Miniflux")
+
+var (
+	templatesDirFlag    = flag.String("templates-dir", "", "directory of templates overriding the embedded ones, by file name")
+	templatesReloadFlag = flag.Bool("templates-reload", false, "load templates again when they change, for development")
+)
+
+var conversionFlag = flag.String("conversion", "", "options converting entry content to gemtext, like links=plain,images=none,tables=pretty,link_frequency=2,heading_offset=1")
+
+var (
+	mediaProxyFlag        = flag.Bool("media-proxy", false, "serve images and enclosures of entries through the server, instead of linking to their http(s) URL")
+	mediaMaxSizeFlag      = flag.Int64("media-max-size", 10<<20, "largest file the media proxy serves, in bytes")
+	mediaTypesFlag        = flag.String("media-types", "image/,audio/,video/", "MIME types the media proxy serves, as comma-separated prefixes")
+	readMaxSizeFlag       = flag.Int64("read-max-size", 2<<20, "largest web page /read converts to gemtext, in bytes")
+	fetchAllowPrivateFlag = flag.Bool("fetch-allow-private", false, "let links in feeds reach private and loopback addresses, other than the Miniflux instance of the user")
+)
+
+var (
+	geminiFeedAddrFlag  = flag.String("gemini-feed-addr", "", "address of the HTTP listener serving feeds of Gemini capsules as Atom for Miniflux, at /gemini-feed?token=&url=, disabled if empty")
+	geminiFeedTokenFlag = flag.String("gemini-feed-token", "", "secret Miniflux passes in the token parameter of /gemini-feed, required with -gemini-feed-addr")
+)
+
+var logFormatFlag = flag.String("log-format", "logfmt", "format of the access log, json or logfmt")
+
+var metricsAddrFlag = flag.String("metrics-addr", "", "address of the HTTP listener exposing Prometheus metrics, disabled if empty")
+
+var (
+	healthAddrFlag          = flag.String("health-addr", "", "address of the HTTP listener for /healthz and /readyz, disabled if empty")
+	healthMinValidityFlag   = flag.Duration("health-min-validity", 7*24*time.Hour, "the server isn’t ready when its certificate expires sooner than that")
+	healthCheckMinifluxFlag = flag.Bool("health-check-miniflux", false, "the server isn’t ready when a Miniflux instance of a user doesn’t answer")
+)
+
+// Open the database with open and load the server certificates
+func openStores(open func(string) (*SqliteDB, error)) (*SqliteDB, *certificate.Store, error) {
+	db, err := open("miniflux-gemini.db")
 	if err != nil {
-		return fmt.Errorf("NewDB: %w", err)
+		return nil, nil, fmt.Errorf("opening the database: %w", err)
 	}
 
 	certificates := &certificate.Store{}
 	certificates.Register(*hostFlag)
 	if err := certificates.Load("./certs"); err != nil {
+		return nil, nil, err
+	}
+
+	return db, certificates, nil
+}
+
+// Health runs the readiness checks once, for use in container health checks.
+// It doesn’t create the database, so that it fails when the file is missing
+func Health() error {
+	db, certificates, err := openStores(OpenDBReadOnly)
+	if err != nil {
+		return err
+	}
+
+	healthChecker, err := NewHealthChecker(db, certificates, *hostFlag, *healthMinValidityFlag, *healthCheckMinifluxFlag)
+	if err != nil {
+		return err
+	}
+	if err := healthChecker.Check(context.Background()); err != nil {
 		return err
 	}
-	log.Println("Got TLS certificate for:", *hostFlag)
 
+	fmt.Println("ok")
+	return nil
+}
+
+// newMux routes requests to handlers and returns the patterns it routes. The
+// media proxy is optional, reader fetches the web pages converted by /read
+func newMux(db *SqliteDB, proxy *mediaProxy, reader fetcher) (*gemini.Mux, []string) {
+	routes := map[string]gemini.HandlerFunc{
+		"/":            homeHandler(db),
+		"/entry":       entryHandler,
+		"/mark_as":     markAsHandler,
+		"/read_next":   readNextHandler,
+		"/save":        saveHandler,
+		"/settings":    settingsHandler,
+		"/settings/":   settingHandler(db),
+		"/conversion/": conversionHandler(db),
+		"/media":       mediaHandler,
+		"/history":     historyHandler,
+		"/tags":        tagsHandler,
+		"/views":       viewsHandler(db),
+		"/views/":      viewsHandler(db),
+		"/feed.gmi":    entryFeedHandler(false),
+		"/feed.atom":   entryFeedHandler(true),
+		"/read":        readHandler(reader),
+		"/subscribe":   subscribeHandler,
+		"/subscribe/":  createFeedHandler,
+	}
+	if proxy != nil {
+		routes["/proxy/"] = proxy.handle
+	}
 	mux := &gemini.Mux{}
-	mux.HandleFunc("/", homeHandler)
-	mux.HandleFunc("/entry", entryHandler)
-	mux.HandleFunc("/mark_as", markAsHandler)
+	patterns := make([]string, 0, len(routes))
+	for pattern, handler := range routes {
+		mux.HandleFunc(pattern, handler)
+		patterns = append(patterns, pattern)
+	}
+	return mux, patterns
+}
+
+func Run() error {
+	if err := gemtext.LoadTemplates(*templatesDirFlag, *templatesReloadFlag); err != nil {
+		return err
+	}
+
+	db, certificates, err := openStores(NewDB)
+	if err != nil {
+		return err
+	}
+	// The store creates missing certificates on the first handshake, which
+	// the readiness checks would wait for
+	if _, err := certificates.Get(*hostFlag); err != nil {
+		return fmt.Errorf("creating the TLS certificate: %w", err)
+	}
+	log.Println("Got TLS certificate for:", *hostFlag)
+
+	if *healthAddrFlag != "" {
+		healthChecker, err := NewHealthChecker(db, certificates, *hostFlag, *healthMinValidityFlag, *healthCheckMinifluxFlag)
+		if err != nil {
+			return err
+		}
+		go func() {
+			log.Println("Health checks listening on:", *healthAddrFlag)
+			if err := http.ListenAndServe(*healthAddrFlag, healthChecker); err != nil {
+				log.Fatalf("health: %v", err)
+			}
+		}()
+	}
+
+	if *geminiFeedAddrFlag != "" {
+		if *geminiFeedTokenFlag == "" {
+			return fmt.Errorf("-gemini-feed-token is required with -gemini-feed-addr")
+		}
+		capsules := &http.Server{
+			Addr:              *geminiFeedAddrFlag,
+			Handler:           newCapsuleFeeds(*fetchAllowPrivateFlag, *geminiFeedTokenFlag),
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      capsuleTimeout + 5*time.Second,
+		}
+		go func() {
+			log.Println("Gemini feeds listening on:", *geminiFeedAddrFlag)
+			if err := capsules.ListenAndServe(); err != nil {
+				log.Fatalf("gemini feeds: %v", err)
+			}
+		}()
+	}
+
+	var proxy *mediaProxy
+	if *mediaProxyFlag {
+		proxy, err = newMediaProxy(fetcher{
+			maxSize:      *mediaMaxSizeFlag,
+			types:        splitList(*mediaTypesFlag),
+			allowPrivate: *fetchAllowPrivateFlag,
+		})
+		if err != nil {
+			return err
+		}
+		gemtext.ProxyMedia = proxy.URL
+	}
+
+	reader := fetcher{
+		maxSize:      *readMaxSizeFlag,
+		types:        []string{"text/html", "application/xhtml+xml"},
+		allowPrivate: *fetchAllowPrivateFlag,
+	}
+	mux, patterns := newMux(db, proxy, reader)
 
 	userMiddleware, err := NewUserMiddleware(db, mux)
 	if err != nil {
 		return err
 	}
 
+	rateLimitMiddleware, err := NewRateLimitMiddleware(
+		db,
+		newRateLimiter(*certRateFlag, *certBurstFlag),
+		newRateLimiter(*ipRateFlag, *ipBurstFlag),
+		*maxConcurrentFlag,
+		userMiddleware,
+	)
+	if err != nil {
+		return err
+	}
+
+	var handler gemini.Handler = rateLimitMiddleware
+	if *metricsAddrFlag != "" {
+		metrics := NewMetrics()
+		gemtext.ObserveConversion = metrics.ObserveConversion
+		handler, err = NewMetricsMiddleware(metrics, patterns, rateLimitMiddleware)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			log.Println("Metrics listening on:", *metricsAddrFlag)
+			if err := metrics.ListenAndServe(*metricsAddrFlag); err != nil {
+				log.Fatalf("metrics: %v", err)
+			}
+		}()
+	}
+
+	accessLogger, err := newAccessLogger(os.Stdout, *logFormatFlag)
+	if err != nil {
+		return err
+	}
+	accessLogMiddleware, err := NewAccessLogMiddleware(accessLogger, handler)
+	if err != nil {
+		return err
+	}
+
 	server := &gemini.Server{
 		Addr:           "0.0.0.0:1965",
-		Handler:        userMiddleware,
+		Handler:        accessLogMiddleware,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		GetCertificate: certificates.Get,
@@ -74,9 +275,27 @@ func Run() error {
 func main() {
 	flag.Parse()
 
-	err := Run()
+	if !slices.Contains(gemtext.Languages, *languageFlag) {
+		log.Fatalf("unknown language %q, expected one of %v", *languageFlag, gemtext.Languages)
+	}
+	gemtext.DefaultLanguage = *languageFlag
+
+	conversion, err := gemtext.ParseConversionOptions(*conversionFlag)
 	if err != nil {
-		log.Fatalf("Run: %v", err)
+		log.Fatalf("-conversion: %v", err)
 	}
-}
+	gemtext.DefaultConversion = conversion
 
+	switch flag.Arg(0) {
+	case "":
+		if err := Run(); err != nil {
+			log.Fatalf("Run: %v", err)
+		}
+	case "health":
+		if err := Health(); err != nil {
+			log.Fatalf("Health: %v", err)
+		}
+	default:
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+}
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	minifluxClient "miniflux.app/client"
+)
+
+// Calls to endpoints of the Miniflux API that the client doesn’t support
+
+var minifluxHTTP = &http.Client{Timeout: 80 * time.Second}
+
+// Entry contents can be large, but not that much
+const maxMinifluxResponse = 16 << 20
+
+// minifluxStatusError is returned for the errors of the API the client has
+// no error for, so that callers can tell them apart
+type minifluxStatusError struct {
+	code    int
+	message string
+}
+
+func (err *minifluxStatusError) Error() string {
+	return fmt.Sprintf("miniflux: status code=%d: %s", err.code, err.message)
+}
+
+// minifluxAPI calls the Miniflux API of the user and decodes the JSON answer
+// in result, unless it is nil. Errors are the ones of the client, so that
+// minifluxError handles them
+func minifluxAPI(ctx context.Context, method, path string, result any) error {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("couldn’t get user")
+	}
+	// Like the client, accept instances with or without /v1
+	endpoint := strings.TrimSuffix(strings.TrimSuffix(user.instance, "/"), "/v1")
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", user.token)
+	req.Header.Set("Accept", "application/json")
+	start := time.Now()
+	resp, err := minifluxHTTP.Do(req)
+	MetricsFromContext(ctx).observeMiniflux(minifluxEndpoint(method, path), time.Since(start), err != nil || resp.StatusCode >= 400)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return minifluxClient.ErrNotAuthorized
+	case http.StatusForbidden:
+		return minifluxClient.ErrForbidden
+	case http.StatusNotFound:
+		return minifluxClient.ErrNotFound
+	}
+	if resp.StatusCode >= 400 {
+		var answer struct {
+			ErrorMessage string `json:"error_message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, maxMinifluxResponse)).Decode(&answer)
+		return &minifluxStatusError{code: resp.StatusCode, message: answer.ErrorMessage}
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxMinifluxResponse)).Decode(result); err != nil {
+		return fmt.Errorf("miniflux: invalid answer to %s: %w", path, err)
+	}
+	return nil
+}
+
+// fetchContent returns the content of the original page of the entry, as
+// extracted by Miniflux. It isn’t saved in Miniflux
+func fetchContent(ctx context.Context, entryID int64) (string, error) {
+	var answer struct {
+		Content string `json:"content"`
+	}
+	err := minifluxAPI(ctx, http.MethodGet, fmt.Sprintf("/v1/entries/%d/fetch-content", entryID), &answer)
+	return answer.Content, err
+}
+
+// errNoIntegration is returned when saving an entry while no third-party
+// integration is enabled in Miniflux
+var errNoIntegration = errors.New("no third-party integration enabled")
+
+// saveEntry sends the entry to the third-party integrations enabled in
+// Miniflux, like Wallabag or Linkding
+func saveEntry(ctx context.Context, entryID int64) error {
+	err := minifluxAPI(ctx, http.MethodPost, fmt.Sprintf("/v1/entries/%d/save", entryID), nil)
+	// Miniflux answers bad request when there is no integration to save to
+	var statusErr *minifluxStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusBadRequest {
+		return fmt.Errorf("%w: %s", errNoIntegration, statusErr.message)
+	}
+	return err
+}
+
+// mediaProgressions returns the position reached in the enclosures of the
+// entry, in seconds, by enclosure ID. The client doesn’t decode it
+func mediaProgressions(ctx context.Context, entryID int64) (map[int64]int, error) {
+	var answer struct {
+		Enclosures []struct {
+			ID               int64 `json:"id"`
+			MediaProgression int   `json:"media_progression"`
+		} `json:"enclosures"`
+	}
+	err := minifluxAPI(ctx, http.MethodGet, fmt.Sprintf("/v1/entries/%d", entryID), &answer)
+	if err != nil {
+		return nil, err
+	}
+
+	progressions := make(map[int64]int, len(answer.Enclosures))
+	for _, enclosure := range answer.Enclosures {
+		progressions[enclosure.ID] = enclosure.MediaProgression
+	}
+	return progressions, nil
+}
+
+// MinifluxClient is the Miniflux client of a user, measuring its calls to the
+// API when metrics are enabled. The client of the library doesn’t take an HTTP
+// client to instrument, so the methods the handlers use are wrapped instead
+type MinifluxClient struct {
+	*minifluxClient.Client
+	metrics *Metrics
+}
+
+// observe measures a call started at start, with the error returned by the
+// wrapped method, which it replaces with a minifluxStatusError for statuses
+// the client has no error for
+func (c *MinifluxClient) observe(endpoint string, start time.Time, err *error) {
+	*err = clientStatusError(*err)
+	c.metrics.observeMiniflux(endpoint, time.Since(start), *err != nil)
+}
+
+// clientStatusError turns the error the client formats for statuses it has no
+// error for, like 429, into a minifluxStatusError. TestMinifluxTooManyRequests
+// checks that the client still formats them like this
+func clientStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var code int
+	if _, scanErr := fmt.Sscanf(err.Error(), "miniflux: status code=%d", &code); scanErr != nil {
+		return err
+	}
+	return &minifluxStatusError{code: code}
+}
+
+func (c *MinifluxClient) Me() (me *minifluxClient.User, err error) {
+	defer c.observe("GET /v1/me", time.Now(), &err)
+	return c.Client.Me()
+}
+
+func (c *MinifluxClient) Discover(url string) (subscriptions minifluxClient.Subscriptions, err error) {
+	defer c.observe("POST /v1/discover", time.Now(), &err)
+	return c.Client.Discover(url)
+}
+
+func (c *MinifluxClient) Categories() (categories minifluxClient.Categories, err error) {
+	defer c.observe("GET /v1/categories", time.Now(), &err)
+	return c.Client.Categories()
+}
+
+func (c *MinifluxClient) Feeds() (feeds minifluxClient.Feeds, err error) {
+	defer c.observe("GET /v1/feeds", time.Now(), &err)
+	return c.Client.Feeds()
+}
+
+func (c *MinifluxClient) Feed(feedID int64) (feed *minifluxClient.Feed, err error) {
+	defer c.observe("GET /v1/feeds/:id", time.Now(), &err)
+	return c.Client.Feed(feedID)
+}
+
+func (c *MinifluxClient) CreateFeed(request *minifluxClient.FeedCreationRequest) (feedID int64, err error) {
+	defer c.observe("POST /v1/feeds", time.Now(), &err)
+	return c.Client.CreateFeed(request)
+}
+
+func (c *MinifluxClient) RefreshAllFeeds() (err error) {
+	defer c.observe("PUT /v1/feeds/refresh", time.Now(), &err)
+	return c.Client.RefreshAllFeeds()
+}
+
+func (c *MinifluxClient) FetchCounters() (counters *minifluxClient.FeedCounters, err error) {
+	defer c.observe("GET /v1/feeds/counters", time.Now(), &err)
+	return c.Client.FetchCounters()
+}
+
+func (c *MinifluxClient) Entry(entryID int64) (entry *minifluxClient.Entry, err error) {
+	defer c.observe("GET /v1/entries/:id", time.Now(), &err)
+	return c.Client.Entry(entryID)
+}
+
+func (c *MinifluxClient) Entries(filter *minifluxClient.Filter) (entries *minifluxClient.EntryResultSet, err error) {
+	defer c.observe("GET /v1/entries", time.Now(), &err)
+	return c.Client.Entries(filter)
+}
+
+func (c *MinifluxClient) UpdateEntries(entryIDs []int64, status string) (err error) {
+	defer c.observe("PUT /v1/entries", time.Now(), &err)
+	return c.Client.UpdateEntries(entryIDs, status)
+}
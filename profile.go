@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"cj.rs/miniflux-gemini/gemtext"
+)
+
+// Miniflux profiles rarely change, so they are cached instead of being
+// fetched for every page showing dates
+const profileTTL = 10 * time.Minute
+
+type profile struct {
+	timezone, language string
+	fetched            time.Time
+}
+
+// profileCache keeps the Miniflux profile of users, by certificate
+// fingerprint
+type profileCache struct {
+	mu       sync.Mutex
+	profiles map[string]profile
+}
+
+var profiles = &profileCache{profiles: make(map[string]profile)}
+
+func (pc *profileCache) get(fingerprint string, miniflux *MinifluxClient, now time.Time) (profile, error) {
+	pc.mu.Lock()
+	cached, ok := pc.profiles[fingerprint]
+	pc.mu.Unlock()
+	if ok && now.Sub(cached.fetched) < profileTTL {
+		return cached, nil
+	}
+
+	me, err := miniflux.Me()
+	if err != nil {
+		return profile{}, err
+	}
+	cached = profile{timezone: me.Timezone, language: me.Language, fetched: now}
+
+	pc.mu.Lock()
+	pc.profiles[fingerprint] = cached
+	pc.mu.Unlock()
+	return cached, nil
+}
+
+// cached returns the last profile fetched for the user, however old
+func (pc *profileCache) cached(fingerprint string) (profile, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	cached, ok := pc.profiles[fingerprint]
+	return cached, ok
+}
+
+// effectiveSettings returns the settings of the user, with the timezone and
+// language of their Miniflux profile unless they chose others. Dates are in
+// UTC and English when the profile can’t be fetched.
+func effectiveSettings(ctx context.Context, miniflux *MinifluxClient) gemtext.Settings {
+	settings := getSettings(ctx)
+	if settings.Timezone != "" && settings.Language != "" {
+		return settings
+	}
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		return settings
+	}
+
+	profile, err := profiles.get(user.certFingerprint, miniflux, time.Now())
+	if err != nil {
+		log.Printf("error getting miniflux profile: %v", err)
+		return settings
+	}
+	return settings.WithProfile(profile.timezone, profile.language)
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// mediaProxy serves images and enclosures of entries through the server, for
+// Gemini clients that don’t open http(s) links, and so that their hosts
+// don’t see who reads what. Links are signed, so that it only gets what
+// entries link to
+type mediaProxy struct {
+	fetcher
+	// Signs links, it changes when the server restarts
+	key []byte
+}
+
+func newMediaProxy(f fetcher) (*mediaProxy, error) {
+	if f.maxSize <= 0 || len(f.types) == 0 {
+		return nil, fmt.Errorf("newMediaProxy: no size or MIME type allowed")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("newMediaProxy: %w", err)
+	}
+	return &mediaProxy{fetcher: f, key: key}, nil
+}
+
+func (p *mediaProxy) sign(target string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(target))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns the link to get target through the proxy
+func (p *mediaProxy) URL(target string) string {
+	return "/proxy/" + p.sign(target) + "?" + gemini.QueryEscape(target)
+}
+
+func (p *mediaProxy) handle(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	user, ok := UserFromContext(ctx)
+	if !ok {
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Unexpected error"))
+		log.Printf("couldn’t get user")
+		return
+	}
+
+	signature := strings.TrimPrefix(r.URL.Path, "/proxy/")
+	target, err := gemini.QueryUnescape(r.URL.RawQuery)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(p.sign(target))) {
+		w.WriteHeader(gemini.StatusBadRequest, translate(ctx, "Invalid or expired media link"))
+		return
+	}
+
+	mediaType, body, err := p.fetch(ctx, target, user.instance)
+	switch {
+	case errors.Is(err, errTooLarge):
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "The file is too large"))
+		return
+	case errors.Is(err, errForbiddenType):
+		w.WriteHeader(gemini.StatusPermanentFailure, translate(ctx, "Files of this type aren’t served"))
+		return
+	case err != nil:
+		w.WriteHeader(gemini.StatusProxyError, translate(ctx, "Couldn’t get the file"))
+		log.Printf("%s: error proxying %q: %v", shortFingerprint(user.certFingerprint), target, err)
+		return
+	}
+
+	w.SetMediaType(mediaType)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("error writing proxied media: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per key (certificate fingerprint or IP)
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64 // Tokens added per second
+	burst   float64 // Maximum number of tokens in a bucket
+	buckets map[string]*list.Element
+	// Of buckets, the last used first
+	order *list.List
+}
+
+// Past that many buckets, the least recently used ones are forgotten, they
+// are the most likely to be full again
+const maxBuckets = 10000
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// allow takes a token from the bucket of key. When the bucket is empty, it
+// returns false and how long to wait before the next token is available
+func (rl *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	elem, ok := rl.buckets[key]
+	if ok {
+		rl.order.MoveToFront(elem)
+	} else {
+		if rl.order.Len() >= maxBuckets {
+			oldest := rl.order.Remove(rl.order.Back()).(*tokenBucket)
+			delete(rl.buckets, oldest.key)
+		}
+		elem = rl.order.PushFront(&tokenBucket{key: key, tokens: rl.burst, last: now})
+		rl.buckets[key] = elem
+	}
+	bucket := elem.Value.(*tokenBucket)
+
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.tokens = math.Min(rl.burst, bucket.tokens+elapsed*rl.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := (1 - bucket.tokens) / rl.rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// RateLimitMiddleware limits the requests per certificate of a user, per IP
+// for the other requests, and the number of requests served at the same time.
+// Unknown certificates count against their IP, as clients could send a new one
+// with each request
+type RateLimitMiddleware struct {
+	db    *SqliteDB
+	certs *rateLimiter
+	ips   *rateLimiter
+	slots chan struct{}
+	h     gemini.Handler
+}
+
+func NewRateLimitMiddleware(db *SqliteDB, certs, ips *rateLimiter, maxConcurrent int, h gemini.Handler) (*RateLimitMiddleware, error) {
+	if db == nil || certs == nil || ips == nil || h == nil {
+		return nil, fmt.Errorf(
+			"NewRateLimitMiddleware: nil values not allowed",
+		)
+	}
+	if maxConcurrent < 1 {
+		return nil, fmt.Errorf(
+			"NewRateLimitMiddleware: at least one concurrent request must be allowed, got %d",
+			maxConcurrent,
+		)
+	}
+	if certs.rate <= 0 || ips.rate <= 0 {
+		return nil, fmt.Errorf(
+			"NewRateLimitMiddleware: rates must be positive",
+		)
+	}
+	return &RateLimitMiddleware{
+		db:    db,
+		certs: certs,
+		ips:   ips,
+		slots: make(chan struct{}, maxConcurrent),
+		h:     h,
+	}, nil
+}
+
+func (rm *RateLimitMiddleware) ServeGemini(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	var allowed bool
+	var wait time.Duration
+	ctx, certFingerprint, ok := rm.user(ctx, r)
+	if ok {
+		allowed, wait = rm.certs.allow(certFingerprint, time.Now())
+	} else {
+		allowed, wait = rm.ips.allow(ipKey(remoteIP(r)), time.Now())
+	}
+	if !allowed {
+		slowDown(w, wait)
+		return
+	}
+
+	select {
+	case rm.slots <- struct{}{}:
+		defer func() { <-rm.slots }()
+	default:
+		slowDown(w, time.Second)
+		return
+	}
+
+	rm.h.ServeGemini(ctx, w, r)
+}
+
+// user returns the fingerprint of the client certificate when it belongs to a
+// user, and the context keeping the user for UserMiddleware
+func (rm *RateLimitMiddleware) user(ctx context.Context, r *gemini.Request) (context.Context, string, bool) {
+	tls := r.TLS()
+	if tls == nil || len(tls.PeerCertificates) == 0 {
+		return ctx, "", false
+	}
+	certFingerprint := fingerprint(tls.PeerCertificates[0])
+	ctx, _, err := lookupUser(ctx, rm.db, certFingerprint)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Printf("error looking up the user to rate limit: %v", err)
+	}
+	return ctx, certFingerprint, err == nil
+}
+
+// slowDown asks the client to wait, rounded up to the next second
+func slowDown(w gemini.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.WriteHeader(gemini.StatusSlowDown, fmt.Sprint(seconds))
+}
+
+func remoteIP(r *gemini.Request) string {
+	conn := r.Conn()
+	if conn == nil {
+		return ""
+	}
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// ipKey returns the bucket of ip: IPv6 hosts usually get a /64 and pick
+// addresses in it, so they are limited by /64
+func ipKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return ip
+	}
+	prefix, err := addr.Prefix(64)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
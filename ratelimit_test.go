@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+// Copyright Clément Joly and contributors.
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+func TestRateLimitRotatingCertificates(t *testing.T) {
+	h := newHarness(t)
+	rateLimit, err := NewRateLimitMiddleware(h.db, newRateLimiter(0.001, 3), newRateLimiter(0.001, 2), 4, h.handler)
+	if err != nil {
+		t.Fatalf("NewRateLimitMiddleware: %v", err)
+	}
+	h.handler = rateLimit
+
+	// A new certificate for each request still counts against the IP
+	for i := range 3 {
+		cert := newCertificate(t, "stranger")
+		resp, _ := h.get(t, "/", &cert)
+		want := gemini.StatusCertificateNotAuthorized
+		if i == 2 {
+			want = gemini.StatusSlowDown
+		}
+		if resp.Status != want {
+			t.Errorf("status = %d for certificate %d, want %d", resp.Status, i, want)
+		}
+	}
+	resp, _ := h.get(t, "/", nil)
+	if resp.Status != gemini.StatusSlowDown {
+		t.Errorf("status = %d without certificate, want %d", resp.Status, gemini.StatusSlowDown)
+	}
+
+	// Users have their own bucket, whatever their IP did
+	for i := range 3 {
+		resp, _ := h.get(t, "/", &h.cert)
+		if resp.Status != gemini.StatusSuccess {
+			t.Fatalf("status = %d for request %d of the user, want %d", resp.Status, i, gemini.StatusSuccess)
+		}
+	}
+	resp, _ = h.get(t, "/", &h.cert)
+	if resp.Status != gemini.StatusSlowDown {
+		t.Errorf("status = %d past the burst of the user, want %d", resp.Status, gemini.StatusSlowDown)
+	}
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	rl := newRateLimiter(0.001, 2)
+	now := time.Now()
+	rl.allow("first", now)
+	rl.allow("first", now)
+	for i := range maxBuckets {
+		rl.allow(fmt.Sprint(i), now)
+	}
+	if len(rl.buckets) != maxBuckets || rl.order.Len() != maxBuckets {
+		t.Fatalf("%d buckets, want %d", len(rl.buckets), maxBuckets)
+	}
+	if _, ok := rl.buckets["first"]; ok {
+		t.Errorf("the least recently used bucket wasn’t forgotten")
+	}
+	if _, ok := rl.buckets["0"]; !ok {
+		t.Errorf("a more recent bucket was forgotten")
+	}
+}
+
+func TestIPKey(t *testing.T) {
+	for ip, want := range map[string]string{
+		"192.0.2.1":            "192.0.2.1",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff::1": "2001:db8:1:2::/64",
+		"::ffff:192.0.2.1":     "::ffff:192.0.2.1",
+		"":                     "",
+	} {
+		if got := ipKey(ip); got != want {
+			t.Errorf("ipKey(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestLookupUserOnce(t *testing.T) {
+	h := newHarness(t)
+	certFingerprint := fingerprint(h.cert.Leaf)
+	ctx, _, err := lookupUser(context.Background(), h.db, certFingerprint)
+	if err != nil {
+		t.Fatalf("lookupUser: %v", err)
+	}
+
+	// The next middlewares get the user from the context
+	h.db.db.Close()
+	if _, user, err := lookupUser(ctx, h.db, certFingerprint); err != nil || user.certFingerprint != certFingerprint {
+		t.Errorf("lookupUser = %+v, %v, want the user found before", user, err)
+	}
+	if _, _, err := lookupUser(ctx, h.db, "other"); err == nil {
+		t.Errorf("lookupUser found another certificate in the context")
+	}
+}
@@ -23,3 +23,48 @@ CREATE TABLE IF NOT EXISTS Users (
 	-- Miniflux API token
 	token TEXT NOT NULL
 ) STRICT;
+
+-- Existing tables are left as they are: columns added to a table also need a
+-- step in migrations, in db.go, for databases created before
+
+CREATE TABLE IF NOT EXISTS Settings (
+	-- User these settings belong to
+	certFingerprint TEXT PRIMARY KEY NOT NULL,
+	-- Default order and direction of the article list, as in the Miniflux API
+	entryOrder TEXT NOT NULL,
+	entryDirection TEXT NOT NULL,
+	-- Number of entries in list views
+	pageSize INTEGER NOT NULL,
+	-- When entries are automatically marked as read: never, open or next
+	autoMarkRead TEXT NOT NULL,
+	-- Go time layout for dates
+	dateFormat TEXT NOT NULL,
+	-- IANA timezone for dates, empty to use the one of the Miniflux profile
+	timezone TEXT NOT NULL,
+	-- Language of dates, empty to use the one of the Miniflux profile
+	language TEXT NOT NULL,
+	-- Whether feeds without unread entries are hidden on the home page (0 or 1)
+	hideEmptyFeeds INTEGER NOT NULL,
+	-- Length of the pages long entries are split in, in kB, 0 to never split
+	pageLength INTEGER NOT NULL
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS ConversionOptions (
+	-- User these options belong to
+	certFingerprint TEXT NOT NULL,
+	-- Feed the options apply to, 0 for all the feeds of the user
+	feedID INTEGER NOT NULL,
+	-- Options overriding the ones of the server, as a query like links=plain
+	options TEXT NOT NULL,
+	PRIMARY KEY (certFingerprint, feedID)
+) STRICT;
+
+CREATE TABLE IF NOT EXISTS Views (
+	id INTEGER PRIMARY KEY,
+	-- User this view belongs to
+	certFingerprint TEXT NOT NULL,
+	-- Name shown on the home page
+	name TEXT NOT NULL,
+	-- Filter of the article list, as a query like feedID=1&starred=true
+	filter TEXT NOT NULL
+) STRICT;